@@ -0,0 +1,92 @@
+// Package catalog names ingredients the way the ingredient catalog does,
+// so the same food written different ways is recognised as one: by the
+// catalog's rows, the shopping list's aisles, the pantry and the tables of
+// densities and nutrients.
+package catalog
+
+import "strings"
+
+// Name returns the catalog form of an ingredient name, so that "2 Large
+// Eggs, beaten" and "egg" land on the same row: lowercased, without notes in
+// parentheses or after a comma, without numbers or preparation words, and
+// with the last word made singular.
+func Name(name string) string {
+	name = strings.ToLower(name)
+	if i := strings.Index(name, ","); i >= 0 {
+		name = name[:i]
+	}
+	for {
+		open := strings.Index(name, "(")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(name[open:], ")")
+		if end < 0 {
+			name = name[:open]
+			break
+		}
+		name = name[:open] + " " + name[open+end+1:]
+	}
+
+	words := make([]string, 0, 4)
+	for _, word := range strings.Fields(name) {
+		word = strings.Trim(word, ".,;:!?*\"'")
+		if word == "" || preparationWords[word] || (word[0] >= '0' && word[0] <= '9') {
+			continue
+		}
+		words = append(words, word)
+	}
+	if len(words) == 0 {
+		// Nothing but preparation words: better the name as typed than
+		// nothing at all.
+		return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	}
+	words[len(words)-1] = singular(words[len(words)-1])
+	return strings.Join(words, " ")
+}
+
+// preparationWords describe how an ingredient is cut or prepared rather than
+// what it is.
+var preparationWords = map[string]bool{
+	"fresh": true, "freshly": true, "large": true, "medium": true, "small": true,
+	"chopped": true, "diced": true, "minced": true, "sliced": true, "grated": true,
+	"shredded": true, "crushed": true, "peeled": true, "melted": true, "softened": true,
+	"beaten": true, "finely": true, "roughly": true, "coarsely": true, "thinly": true,
+	"cubed": true, "halved": true, "quartered": true, "trimmed": true, "rinsed": true,
+	"drained": true, "packed": true, "sifted": true, "optional": true,
+}
+
+// uncountable words end in "s" without being plural.
+var uncountable = map[string]bool{
+	"molasses": true, "asparagus": true, "hummus": true, "couscous": true,
+	"swiss": true, "grits": true, "citrus": true, "series": true, "brussels": true,
+}
+
+var irregularPlurals = map[string]string{
+	"leaves": "leaf", "loaves": "loaf", "halves": "half", "knives": "knife",
+}
+
+// singular makes an English plural singular, well enough for the nouns that
+// show up in ingredient lists.
+func singular(word string) string {
+	if uncountable[word] || len(word) < 4 {
+		return word
+	}
+	if s, ok := irregularPlurals[word]; ok {
+		return s
+	}
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "oes"),
+		strings.HasSuffix(word, "ches"),
+		strings.HasSuffix(word, "shes"),
+		strings.HasSuffix(word, "sses"),
+		strings.HasSuffix(word, "xes"):
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		return word[:len(word)-1]
+	}
+	return word
+}
@@ -0,0 +1,211 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/pantry"
+	"github.com/imsteev/recipebook/policy"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+type CookController struct {
+	DB     *gorm.DB
+	Engine *views.Engine
+}
+
+// WhatCanICook ranks the user's recipes by how many of their ingredients are
+// on hand. The list comes from ?ingredients=, along with the user's pantry
+// unless they untick it.
+func (c *CookController) WhatCanICook(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.LoggedInUserID(r)
+
+	query := r.URL.Query()
+	list, staples, usePantry := "", true, true
+	if query.Has("ingredients") {
+		list, staples, usePantry = query.Get("ingredients"), query.Get("staples") != "", query.Get("pantry") != ""
+	}
+	have := pantry.Parse(list)
+
+	var items []models.PantryItem
+	if err := c.DB.Where("user_id = ?", userID).Order("name ASC").Find(&items).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if usePantry {
+		for _, item := range items {
+			have = append(have, item.Name)
+		}
+	}
+
+	var matches []pantry.Match
+	if len(have) > 0 {
+		var recipes []models.Recipe
+		err := c.DB.Scopes(policy.ViewableRecipes(userID), preloadIngredients).Find(&recipes).Error
+		if err == nil {
+			err = inheritParents(c.DB, eachRecipe(recipes)...)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if staples {
+			have = append(have, pantry.Staples...)
+		}
+		matches = pantry.Rank(recipes, have)
+	}
+
+	data := map[string]any{
+		"Ingredients":    list,
+		"Staples":        staples,
+		"UsePantry":      usePantry,
+		"PantryItems":    items,
+		"StapleNames":    strings.Join(pantry.Staples, ", "),
+		"Searched":       len(have) > 0,
+		"Matches":        matches,
+		"csrfToken":      csrf.Token(r),
+		csrf.TemplateTag: csrf.TemplateField(r),
+	}
+
+	var err error
+	if r.Header.Get("HX-Target") == "cook-results" {
+		err = c.Engine.RenderPartial(w, "cook.html", "cook-results", data)
+	} else {
+		err = c.Engine.Render(w, "cook.html", data)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// SavePantry adds the ingredients typed in to the user's pantry, without a
+// quantity, skipping any that are already there.
+func (c *CookController) SavePantry(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	userID := middleware.LoggedInUserID(r)
+
+	var have []uint
+	err = c.DB.Model(&models.PantryItem{}).Where("user_id = ?", userID).Pluck("ingredient_id", &have).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	added := 0
+	for _, name := range pantry.Parse(r.PostFormValue("ingredients")) {
+		var ingredient models.Ingredient
+		err := c.DB.Where(models.Ingredient{Name: catalog.Name(name)}).FirstOrCreate(&ingredient).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if slices.Contains(have, ingredient.ID) {
+			continue
+		}
+		item := models.PantryItem{UserID: userID, IngredientID: ingredient.ID, Name: name}
+		if err := c.DB.Create(&item).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		have = append(have, ingredient.ID)
+		added++
+	}
+
+	fmt.Fprintf(w, "Added %d to your pantry", added)
+}
+
+// MarkCooked records the user cooking a recipe and, if they ask, takes its
+// ingredients out of their pantry. The servings they cooked scale what's
+// taken out.
+func (c *CookController) MarkCooked(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	var recipe models.Recipe
+	err = c.DB.Scopes(policy.ViewableRecipes(userID), preloadIngredients).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if _, err := inheritParent(c.DB, &recipe); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	servings, err := parseServings(r.PostFormValue("servings"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	scale := 1.0
+	if servings > 0 && recipe.Servings > 0 {
+		scale = float64(servings) / float64(recipe.Servings)
+	} else {
+		servings = recipe.Servings
+	}
+
+	cooked := models.CookedRecipe{UserID: userID, RecipeID: recipe.ID, Servings: servings}
+	var uses []pantry.Use
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&cooked).Error; err != nil {
+			return err
+		}
+		if r.PostFormValue("deduct") == "" {
+			return nil
+		}
+
+		var items []models.PantryItem
+		if err := tx.Preload("Ingredient").Where("user_id = ?", userID).Find(&items).Error; err != nil {
+			return err
+		}
+		uses = pantry.Deduct(items, recipe, scale)
+		for _, use := range uses {
+			var err error
+			if use.UsedUp {
+				err = tx.Delete(&use.Item).Error
+			} else {
+				err = tx.Model(&use.Item).Update("quantity", use.Item.Quantity).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.RenderPartial(w, "recipes-show.html", "recipe-cooked", map[string]any{
+		"Recipe":         recipe,
+		"Servings":       servings,
+		"LastCooked":     &cooked,
+		"Uses":           uses,
+		"Deducted":       r.PostFormValue("deduct") != "",
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
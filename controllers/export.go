@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/export"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
+	"github.com/imsteev/recipebook/storage"
+	"gorm.io/gorm"
+)
+
+type exportFormat struct {
+	ContentType string
+	Ext         string
+}
+
+// exportFormats are the ?format= values the export handlers take.
+var exportFormats = map[string]exportFormat{
+	"json":     {"application/json", ".json"},
+	"jsonld":   {"application/ld+json", ".jsonld"},
+	"markdown": {"text/markdown; charset=utf-8", ".md"},
+	"zip":      {"application/zip", ".zip"},
+	"pdf":      {"application/pdf", ".pdf"},
+}
+
+type ExportController struct {
+	DB     *gorm.DB
+	Photos storage.Store
+}
+
+// ExportRecipe downloads a recipe the user can see in the ?format= asked for.
+func (c *ExportController) ExportRecipe(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	format, ok := exportFormats[name]
+	if !ok {
+		http.Error(w, "format must be json, jsonld, markdown, zip or pdf", http.StatusBadRequest)
+		return
+	}
+
+	var recipe models.Recipe
+	err := c.DB.Scopes(policy.ViewableRecipes(middleware.LoggedInUserID(r)), preloadIngredients, preloadSteps, preloadTags, preloadPhotos).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if _, err := inheritParent(c.DB, &recipe); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	download(w, format, export.FileName(recipe.Name), func(out io.Writer) error {
+		switch name {
+		case "json":
+			return export.JSON(out, recipe)
+		case "jsonld":
+			return export.JSON(out, export.RecipeJSONLD(recipe, nil))
+		case "markdown":
+			return export.RecipeMarkdown(out, recipe, nil)
+		case "pdf":
+			return export.RecipePDF(out, recipe, c.Photos)
+		}
+		return export.RecipeZip(out, recipe, c.Photos)
+	})
+}
+
+// ExportRecipeBook downloads a recipe book the user can see, with all its
+// recipes, in the ?format= asked for.
+func (c *ExportController) ExportRecipeBook(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("format")
+	format, ok := exportFormats[name]
+	if !ok {
+		http.Error(w, "format must be json, jsonld, markdown, zip or pdf", http.StatusBadRequest)
+		return
+	}
+
+	var recipebook models.RecipeBook
+	err := c.DB.Scopes(policy.ViewableRecipeBooks(middleware.LoggedInUserID(r)), preloadBookRecipes).
+		Preload("Recipes.Recipe.Ingredients", func(db *gorm.DB) *gorm.DB {
+			return db.Order("recipe_ingredients.position ASC")
+		}).
+		Preload("Recipes.Recipe.Ingredients.Ingredient").
+		Preload("Recipes.Recipe.Steps", func(db *gorm.DB) *gorm.DB {
+			return db.Order("recipe_steps.position ASC")
+		}).
+		Preload("Recipes.Recipe.Steps.Ingredients").
+		Preload("Recipes.Recipe.Tags", func(db *gorm.DB) *gorm.DB {
+			return db.Order("tags.kind ASC, tags.name ASC")
+		}).
+		Where("recipe_books.id = ?", mux.Vars(r)["id"]).
+		First(&recipebook).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := inheritParents(c.DB, bookRecipes(recipebook)...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	book := export.NewBook(recipebook)
+	download(w, format, export.FileName(book.Name), func(out io.Writer) error {
+		switch name {
+		case "json":
+			return export.JSON(out, book)
+		case "jsonld":
+			return export.JSON(out, export.BookJSONLD(book))
+		case "markdown":
+			return export.BookMarkdown(out, book)
+		case "pdf":
+			return export.BookPDF(out, book, c.Photos)
+		}
+		return export.BookZip(out, book, c.Photos)
+	})
+}
+
+// download sends an export as an attachment named name. Exports are built
+// in memory so a failure can still be reported, except for zips: photos
+// make those big, so they're streamed and a failure cuts them short.
+func download(w http.ResponseWriter, format exportFormat, name string, write func(io.Writer) error) {
+	filename := name + format.Ext
+	if format.Ext == ".zip" {
+		setDownloadHeaders(w, format, filename)
+		if err := write(w); err != nil {
+			log.Printf("failed to export %s: %v", filename, err)
+		}
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setDownloadHeaders(w, format, filename)
+	buf.WriteTo(w)
+}
+
+func setDownloadHeaders(w http.ResponseWriter, format exportFormat, filename string) {
+	w.Header().Set("Content-Type", format.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+}
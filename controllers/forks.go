@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
+	"gorm.io/gorm"
+)
+
+// ForkRecipe saves a copy of a recipe in a shared recipe book as the logged
+// in user's own, photos and all, pointing back at the original so the copy
+// can credit it.
+func (c *RecipeController) ForkRecipe(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.LoggedInUserID(r)
+
+	_, original, err := findSharedRecipe(c.DB, mux.Vars(r)["slug"], mux.Vars(r)["recipeID"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	photos, err := copyPhotoFiles(c.Photos, original.Photos)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recipe := original.Copy()
+	recipe.UserID = userID
+	recipe.ForkedFromID = &original.ID
+	recipe.Photos = photos
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&recipe).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, models.NewRevision(recipe, userID))
+	})
+	if err != nil {
+		deletePhotoFiles(c.Photos, photos)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/recipes/%d", recipe.ID))
+}
+
+// forkAttribution credits the recipe a copy was made from.
+type forkAttribution struct {
+	Name   string
+	Author string
+	URL    string // empty when the viewer can't see the original
+}
+
+// forkedFrom finds who to credit for a copy of the recipe recipeID. It's
+// still credited once deleted, but then there's nothing to link to. It's
+// nil if the original is gone altogether.
+func forkedFrom(db *gorm.DB, recipeID uint, viewerID uint) (*forkAttribution, error) {
+	var original models.Recipe
+	err := db.Unscoped().First(&original, recipeID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var author models.User
+	if err := db.Unscoped().Find(&author, original.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	attribution := &forkAttribution{Name: original.Name, Author: author.Username}
+	var viewable int64
+	err = db.Model(&models.Recipe{}).
+		Scopes(policy.ViewableRecipes(viewerID)).
+		Where("recipes.id = ?", original.ID).
+		Count(&viewable).Error
+	if err != nil {
+		return nil, err
+	}
+	if viewable > 0 {
+		attribution.URL = fmt.Sprintf("/recipes/%d", original.ID)
+	}
+	return attribution, nil
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+const maxGiftMessageLength = 2000
+
+type GiftController struct {
+	DB     *gorm.DB
+	Engine *views.Engine
+}
+
+// CreateGift offers the book to another user. Only the book's owner (its
+// creator or a previous gift's recipient, not a co-owner) can give it away.
+// Sending a new gift cancels any that are still pending.
+func (c *GiftController) CreateGift(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	var recipebook models.RecipeBook
+	err = c.DB.Where("id = ? AND created_by = ?", mux.Vars(r)["id"], userID).First(&recipebook).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	message := strings.TrimSpace(r.PostFormValue("message"))
+	if utf8.RuneCountInString(message) > maxGiftMessageLength {
+		http.Error(w, fmt.Sprintf("Message must be at most %d characters", maxGiftMessageLength), http.StatusBadRequest)
+		return
+	}
+
+	gift := models.RecipeBookGift{
+		RecipeBookID: recipebook.ID,
+		FromUserID:   userID,
+		ClaimToken:   fmt.Sprintf("%x", securecookie.GenerateRandomKey(32)),
+		Message:      message,
+		Status:       models.GiftPending,
+	}
+
+	if username := strings.TrimSpace(r.PostFormValue("username")); username != "" {
+		var recipient models.User
+		if err := c.DB.Where("username = ?", username).First(&recipient).Error; err != nil {
+			http.Error(w, "No user with that username", http.StatusNotFound)
+			return
+		}
+		if recipient.ID == userID {
+			http.Error(w, "You already own this book", http.StatusBadRequest)
+			return
+		}
+		gift.ToUserID = &recipient.ID
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.RecipeBookGift{}).
+			Where("recipe_book_id = ? AND status = ?", recipebook.ID, models.GiftPending).
+			Update("status", models.GiftCancelled).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&gift).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.RenderPartial(w, "recipebooks-show.html", "book-gift", map[string]any{
+		"RecipeBook":  recipebook,
+		"PendingGift": gift,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetGift shows a gift to its recipient (or, for claim links, to anyone
+// logged in) with the option to accept or decline it.
+func (c *GiftController) GetGift(w http.ResponseWriter, r *http.Request) {
+	gift, err := c.findGift(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	err = c.Engine.Render(w, "gifts-show.html", map[string]any{
+		"Gift":           gift,
+		"IsGiver":        gift.FromUserID == middleware.LoggedInUserID(r),
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// AcceptGift makes the logged in user the book's owner and records the
+// transfer.
+func (c *GiftController) AcceptGift(w http.ResponseWriter, r *http.Request) {
+	gift, err := c.findGift(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	if gift.FromUserID == userID {
+		http.Error(w, "You can't accept your own gift", http.StatusBadRequest)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Only a pending gift from the book's current owner can be
+		// accepted; checking both in the UPDATE keeps two people from
+		// claiming the same link at once.
+		res := tx.Model(&models.RecipeBookGift{}).
+			Where("id = ? AND status = ?", gift.ID, models.GiftPending).
+			Updates(map[string]any{"status": models.GiftAccepted, "to_user_id": userID, "responded_at": now})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errGiftNotPending
+		}
+
+		res = tx.Model(&models.RecipeBook{}).
+			Where("id = ? AND created_by = ?", gift.RecipeBookID, gift.FromUserID).
+			Update("created_by", userID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errGiftNotPending
+		}
+
+		// The new owner doesn't need a membership row any more.
+		err := tx.Where("recipe_book_id = ? AND user_id = ?", gift.RecipeBookID, userID).
+			Delete(&models.RecipeBookMember{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RecipeBookTransfer{
+			RecipeBookID: gift.RecipeBookID,
+			FromUserID:   gift.FromUserID,
+			ToUserID:     userID,
+			GiftID:       gift.ID,
+		}).Error
+	})
+	if errors.Is(err, errGiftNotPending) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/recipebooks/%d", gift.RecipeBookID))
+}
+
+func (c *GiftController) DeclineGift(w http.ResponseWriter, r *http.Request) {
+	gift, err := c.findGift(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	if gift.FromUserID == userID {
+		http.Error(w, "You can't decline your own gift", http.StatusBadRequest)
+		return
+	}
+
+	res := c.DB.Model(&models.RecipeBookGift{}).
+		Where("id = ? AND status = ?", gift.ID, models.GiftPending).
+		Updates(map[string]any{"status": models.GiftDeclined, "to_user_id": userID, "responded_at": time.Now()})
+	if res.Error != nil {
+		http.Error(w, res.Error.Error(), http.StatusInternalServerError)
+		return
+	}
+	if res.RowsAffected == 0 {
+		http.Error(w, errGiftNotPending.Error(), http.StatusConflict)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", "/recipebooks")
+}
+
+var errGiftNotPending = errors.New("this gift is no longer available")
+
+// findGift loads the gift named by the {token} route variable, if the
+// logged in user may see it: the giver, the addressed recipient, or anyone
+// at all for an unaddressed claim link that hasn't been claimed yet.
+func (c *GiftController) findGift(r *http.Request) (models.RecipeBookGift, error) {
+	var gift models.RecipeBookGift
+	err := c.DB.Preload("RecipeBook").Preload("FromUser").
+		Where("claim_token = ?", mux.Vars(r)["token"]).
+		First(&gift).Error
+	if err != nil {
+		return gift, err
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	if gift.FromUserID != userID && gift.ToUserID != nil && *gift.ToUserID != userID {
+		return gift, gorm.ErrRecordNotFound
+	}
+	return gift, nil
+}
@@ -0,0 +1,233 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/imsteev/recipebook/importer"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/photos"
+	"github.com/imsteev/recipebook/quantity"
+	"github.com/imsteev/recipebook/storage"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+// maxImportSize bounds an uploaded export. Paprika's carry every photo.
+const maxImportSize = 512 << 20
+
+type ImportController struct {
+	DB      *gorm.DB
+	Engine  *views.Engine
+	Fetcher importer.Fetcher
+	Photos  storage.Store
+}
+
+// ImportPage asks for the address of a recipe on another site, or for an
+// export from another recipe manager.
+func (c *ImportController) ImportPage(w http.ResponseWriter, r *http.Request) {
+	err := c.Engine.Render(w, "recipes-import.html", map[string]any{
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ImportFromURL reads the recipe at the submitted address and fills in the
+// recipe form with it, so the user can check it over before saving. Nothing
+// is saved until they do.
+func (c *ImportController) ImportFromURL(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	url := strings.TrimSpace(r.PostFormValue("url"))
+	imported, err := importer.FromURL(r.Context(), c.Fetcher, url)
+	if err != nil {
+		message := err.Error()
+		if !errors.Is(err, importer.ErrNoRecipe) {
+			message = "Couldn't read that page: " + message
+		}
+		err = c.Engine.Render(w, "recipes-import.html", map[string]any{
+			"URL":            url,
+			"Error":          message,
+			csrf.TemplateTag: csrf.TemplateField(r),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recipe := importedRecipe(imported)
+	err = c.Engine.Render(w, "recipes-form.html", map[string]any{
+		"Title":          "Import Recipe",
+		"Action":         "/recipes",
+		"Recipe":         recipe,
+		"TagKinds":       models.TagKinds,
+		"TagFields":      tagFields(recipe.Tags),
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// importResult is how importing one recipe from a file went.
+type importResult struct {
+	Source string
+	Name   string
+	Recipe models.Recipe // as saved, when Err is nil
+	Err    error
+}
+
+// ImportFile saves every recipe in an export uploaded from another recipe
+// manager (see importer.FromFile) and reports how each one went. Recipes
+// are saved one at a time, so one that fails doesn't stop the rest.
+func (c *ImportController) ImportFile(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	items, err := importer.FromFile(header.Filename, file, header.Size)
+	if err != nil {
+		err = c.Engine.Render(w, "recipes-import.html", map[string]any{
+			"FileError":      err.Error(),
+			csrf.TemplateTag: csrf.TemplateField(r),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	results := make([]importResult, len(items))
+	failed := 0
+	for i, item := range items {
+		results[i] = importResult{Source: item.Source, Name: item.Recipe.Name, Err: item.Err}
+		if item.Err == nil {
+			results[i].Recipe, results[i].Err = c.saveImported(userID, item.Recipe)
+		}
+		if results[i].Err != nil {
+			failed++
+		}
+	}
+
+	err = c.Engine.Render(w, "recipes-import-results.html", map[string]any{
+		"FileName": header.Filename,
+		"Results":  results,
+		"Imported": len(results) - failed,
+		"Failed":   failed,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// saveImported saves a recipe read from an export for userID, along with
+// any photos that came with it. Photos we can't read are left out rather
+// than losing the recipe over them.
+func (c *ImportController) saveImported(userID uint, imported importer.Recipe) (models.Recipe, error) {
+	var uploads []photos.Photo
+	for _, data := range imported.Photos {
+		if photo, err := photos.Prepare(bytes.NewReader(data)); err == nil {
+			uploads = append(uploads, photo)
+		}
+	}
+	stored, err := storePhotos(c.Photos, uploads, 0)
+	if err != nil {
+		return models.Recipe{}, err
+	}
+
+	form := importedRecipe(imported)
+	recipe := models.Recipe{
+		Name:        form.Name,
+		Description: form.Description,
+		Steps:       form.Steps,
+		Servings:    form.Servings,
+		PrepTime:    form.PrepTime,
+		CookTime:    form.CookTime,
+		SourceURL:   parseSourceURL(form.SourceURL),
+		UserID:      userID,
+		Photos:      stored,
+	}
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		var names, quantities []string
+		for _, ri := range form.Ingredients {
+			names = append(names, ri.Name)
+			quantities = append(quantities, ri.QuantityText)
+		}
+		ingredients, err := parseIngredients(tx, names, quantities)
+		if err != nil {
+			return err
+		}
+		recipe.Ingredients = ingredients
+		recipe.Tags, err = findOrCreateTags(tx, form.Tags)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&recipe).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, models.NewRevision(recipe, userID))
+	})
+	if err != nil {
+		deletePhotoFiles(c.Photos, stored)
+		return models.Recipe{}, err
+	}
+	return recipe, nil
+}
+
+// importedRecipe is an imported recipe as the recipe form shows it. Its
+// ingredient lines are split into name and quantity the way the form asks
+// for them, and its cuisines, categories and keywords become tags.
+func importedRecipe(imported importer.Recipe) models.Recipe {
+	recipe := models.Recipe{
+		Name:        imported.Name,
+		Description: imported.Description,
+		Servings:    imported.Servings,
+		PrepTime:    models.Minutes(imported.PrepTime.Round(time.Minute) / time.Minute),
+		CookTime:    models.Minutes(imported.CookTime.Round(time.Minute) / time.Minute),
+		SourceURL:   imported.SourceURL,
+	}
+	for _, text := range imported.Instructions {
+		recipe.Steps = append(recipe.Steps, models.RecipeStep{Position: len(recipe.Steps), Text: text})
+	}
+	for _, line := range imported.Ingredients {
+		amount, name := quantity.Split(line)
+		recipe.Ingredients = append(recipe.Ingredients, models.RecipeIngredient{
+			Name:         name,
+			QuantityText: amount,
+		})
+	}
+	for _, name := range imported.Cuisines {
+		recipe.Tags = append(recipe.Tags, models.Tag{Kind: models.TagCuisine, Name: models.NormalizeTagName(name)})
+	}
+	for _, name := range imported.Categories {
+		recipe.Tags = append(recipe.Tags, models.Tag{Kind: models.TagCourse, Name: models.NormalizeTagName(name)})
+	}
+	for _, name := range imported.Keywords {
+		recipe.Tags = append(recipe.Tags, models.Tag{Kind: models.TagOther, Name: models.NormalizeTagName(name)})
+	}
+	return recipe
+}
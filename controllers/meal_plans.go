@@ -0,0 +1,295 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+const dateFormat = "2006-01-02"
+
+type MealPlanController struct {
+	DB     *gorm.DB
+	Engine *views.Engine
+}
+
+// GetWeek shows the meal plan for the week (Monday to Sunday) containing the
+// ?week= date, or this week if there isn't one.
+func (c *MealPlanController) GetWeek(w http.ResponseWriter, r *http.Request) {
+	week, err := parseWeek(r.URL.Query().Get("week"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.renderWeek(w, r, week, false)
+}
+
+func (c *MealPlanController) AddMeal(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	date, slot, err := parseMealSlot(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var recipe models.Recipe
+	err = c.DB.Scopes(policy.ViewableRecipes(userID)).
+		Where("recipes.id = ?", r.PostFormValue("recipe_id")).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	meal := models.MealPlan{UserID: userID, Date: date, Slot: slot, RecipeID: recipe.ID}
+	if err := c.DB.Create(&meal).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderWeek(w, r, startOfWeek(date), true)
+}
+
+// MoveMeal moves a planned meal to another day and/or slot. It's what the
+// week grid calls when a recipe is dragged into a different cell.
+func (c *MealPlanController) MoveMeal(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	meal, err := c.findMeal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	date, slot, err := parseMealSlot(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.DB.Model(&meal).Updates(map[string]any{"date": date, "slot": slot}).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderWeek(w, r, startOfWeek(date), true)
+}
+
+func (c *MealPlanController) RemoveMeal(w http.ResponseWriter, r *http.Request) {
+	meal, err := c.findMeal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := c.DB.Delete(&meal).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderWeek(w, r, startOfWeek(meal.Date), true)
+}
+
+// CreateShoppingList makes a shopping list out of every meal planned for the
+// week. A recipe planned twice is bought for twice.
+func (c *MealPlanController) CreateShoppingList(w http.ResponseWriter, r *http.Request) {
+	week, err := parseWeek(r.FormValue("week"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	var meals []models.MealPlan
+	err = c.DB.Preload("Recipe", policy.ViewableRecipes(userID)).
+		Preload("Recipe.Ingredients", func(db *gorm.DB) *gorm.DB {
+			return db.Order("recipe_ingredients.position ASC")
+		}).Preload("Recipe.Ingredients.Ingredient").
+		Where("user_id = ? AND date >= ? AND date < ?", userID, week, week.AddDate(0, 0, 7)).
+		Find(&meals).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	meals = viewableMeals(meals)
+	if len(meals) == 0 {
+		http.Error(w, "Nothing is planned this week", http.StatusBadRequest)
+		return
+	}
+
+	recipes := make([]models.Recipe, len(meals))
+	for i, meal := range meals {
+		recipes[i] = meal.Recipe
+	}
+	if err := inheritParents(c.DB, eachRecipe(recipes)...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	list, err := createShoppingList(c.DB, userID, "Week of "+week.Format("Jan 2"), recipes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/shoppinglists/%d", list.ID))
+}
+
+func (c *MealPlanController) findMeal(r *http.Request) (models.MealPlan, error) {
+	var meal models.MealPlan
+	err := c.DB.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.LoggedInUserID(r)).
+		First(&meal).Error
+	return meal, err
+}
+
+// viewableMeals drops the meals whose recipe the user can no longer see,
+// such as one in a book they've since left. Preloading the recipes with
+// policy.ViewableRecipes leaves those empty.
+func viewableMeals(meals []models.MealPlan) []models.MealPlan {
+	viewable := meals[:0]
+	for _, meal := range meals {
+		if meal.Recipe.ID != 0 {
+			viewable = append(viewable, meal)
+		}
+	}
+	return viewable
+}
+
+type mealPlanRow struct {
+	Slot  string
+	Cells []mealPlanCell
+}
+
+type mealPlanCell struct {
+	Date  string
+	Slot  string
+	Meals []models.MealPlan
+}
+
+// renderWeek renders the week grid, either as a whole page or as just the
+// grid for htmx to swap in.
+func (c *MealPlanController) renderWeek(w http.ResponseWriter, r *http.Request, week time.Time, partial bool) {
+	userID := middleware.LoggedInUserID(r)
+
+	var meals []models.MealPlan
+	err := c.DB.Preload("Recipe", policy.ViewableRecipes(userID)).
+		Where("user_id = ? AND date >= ? AND date < ?", userID, week, week.AddDate(0, 0, 7)).
+		Order("created_at ASC").
+		Find(&meals).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	meals = viewableMeals(meals)
+	planned := make([]*models.Recipe, len(meals))
+	for i := range meals {
+		planned[i] = &meals[i].Recipe
+	}
+	if err := inheritParents(c.DB, planned...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	days := make([]time.Time, 7)
+	for i := range days {
+		days[i] = week.AddDate(0, 0, i)
+	}
+
+	rows := make([]mealPlanRow, len(models.MealSlots))
+	for i, slot := range models.MealSlots {
+		rows[i] = mealPlanRow{Slot: slot, Cells: make([]mealPlanCell, len(days))}
+		for j, day := range days {
+			cell := mealPlanCell{Date: day.Format(dateFormat), Slot: slot}
+			for _, meal := range meals {
+				if meal.Slot == slot && meal.Date.Format(dateFormat) == cell.Date {
+					cell.Meals = append(cell.Meals, meal)
+				}
+			}
+			rows[i].Cells[j] = cell
+		}
+	}
+
+	data := map[string]any{
+		"Week":     week.Format(dateFormat),
+		"PrevWeek": week.AddDate(0, 0, -7).Format(dateFormat),
+		"NextWeek": week.AddDate(0, 0, 7).Format(dateFormat),
+		"Days":     days,
+		"Rows":     rows,
+	}
+
+	if partial {
+		err = c.Engine.RenderPartial(w, "mealplan-week.html", "meal-grid", data)
+	} else {
+		var recipes []models.Recipe
+		if err := c.DB.Scopes(policy.ViewableRecipes(userID)).Find(&recipes).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := inheritParents(c.DB, eachRecipe(recipes)...); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sortRecipes(recipes)
+		data["Recipes"] = recipes
+		data["Slots"] = models.MealSlots
+		data["csrfToken"] = csrf.Token(r)
+		data[csrf.TemplateTag] = csrf.TemplateField(r)
+		err = c.Engine.Render(w, "mealplan-week.html", data)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseWeek returns the Monday of the week containing the given date, or of
+// the current week if s is empty.
+func parseWeek(s string) (time.Time, error) {
+	if s == "" {
+		now := time.Now()
+		return startOfWeek(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)), nil
+	}
+	date, err := time.Parse(dateFormat, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid week %q", s)
+	}
+	return startOfWeek(date), nil
+}
+
+func startOfWeek(date time.Time) time.Time {
+	offset := (int(date.Weekday()) + 6) % 7 // days since Monday
+	return time.Date(date.Year(), date.Month(), date.Day()-offset, 0, 0, 0, 0, time.UTC)
+}
+
+func parseMealSlot(r *http.Request) (time.Time, string, error) {
+	date, err := time.Parse(dateFormat, r.PostFormValue("date"))
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid date %q", r.PostFormValue("date"))
+	}
+	slot := r.PostFormValue("slot")
+	for _, s := range models.MealSlots {
+		if s == slot {
+			return date, slot, nil
+		}
+	}
+	return time.Time{}, "", fmt.Errorf("invalid meal %q", slot)
+}
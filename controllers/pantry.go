@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/quantity"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+// expiringDays is how far ahead we warn about pantry items expiring.
+const expiringDays = 3
+
+type PantryController struct {
+	DB     *gorm.DB
+	Engine *views.Engine
+}
+
+func (c *PantryController) ListPantry(w http.ResponseWriter, r *http.Request) {
+	var items []models.PantryItem
+	err := c.DB.Scopes(pantryOrder).
+		Where("user_id = ?", middleware.LoggedInUserID(r)).
+		Find(&items).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.Render(w, "pantry-list.html", map[string]any{
+		"Items":        items,
+		"ExpiringDays": expiringDays,
+		"csrfToken":    csrf.Token(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *PantryController) NewPantryItem(w http.ResponseWriter, r *http.Request) {
+	err := c.Engine.Render(w, "pantry-form.html", map[string]any{
+		"Action":         "/pantry",
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *PantryController) CreatePantryItem(w http.ResponseWriter, r *http.Request) {
+	item := models.PantryItem{UserID: middleware.LoggedInUserID(r)}
+	if err := c.parsePantryItem(r, &item); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := c.DB.Create(&item).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("HX-Redirect", "/pantry")
+}
+
+func (c *PantryController) EditPantryItem(w http.ResponseWriter, r *http.Request) {
+	item, err := c.findPantryItem(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	expiresOn := ""
+	if item.ExpiresOn != nil {
+		expiresOn = item.ExpiresOn.Format(dateFormat)
+	}
+	err = c.Engine.Render(w, "pantry-form.html", map[string]any{
+		"Action":         fmt.Sprintf("/pantry/%d/edit", item.ID),
+		"Item":           item,
+		"ExpiresOn":      expiresOn,
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *PantryController) UpdatePantryItem(w http.ResponseWriter, r *http.Request) {
+	item, err := c.findPantryItem(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := c.parsePantryItem(r, &item); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = c.DB.Model(&item).Select("ingredient_id", "name", "quantity", "unit", "expires_on").Updates(&item).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Add("HX-Redirect", "/pantry")
+}
+
+func (c *PantryController) DeletePantryItem(w http.ResponseWriter, r *http.Request) {
+	item, err := c.findPantryItem(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := c.DB.Delete(&item).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// htmx removes the row by swapping in nothing.
+}
+
+// parsePantryItem fills item in from the submitted form: the ingredient,
+// an amount like "2 cups" or "500 g", and an optional expiry date.
+func (c *PantryController) parsePantryItem(r *http.Request, item *models.PantryItem) error {
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if name == "" {
+		return fmt.Errorf("name is required")
+	}
+	var ingredient models.Ingredient
+	err := c.DB.Where(models.Ingredient{Name: catalog.Name(name)}).FirstOrCreate(&ingredient).Error
+	if err != nil {
+		return fmt.Errorf("failed to find or create ingredient %q: %w", name, err)
+	}
+
+	amount := quantity.Parse(strings.TrimSpace(r.PostFormValue("quantity")))
+	if amount.IsRange() {
+		amount.Value = amount.Max
+	}
+
+	item.IngredientID = ingredient.ID
+	item.Name = name
+	item.Quantity = amount.Value
+	item.Unit = amount.Unit
+	item.ExpiresOn = nil
+	if v := r.PostFormValue("expires_on"); v != "" {
+		date, err := time.Parse(dateFormat, v)
+		if err != nil {
+			return fmt.Errorf("invalid expiry date %q", v)
+		}
+		item.ExpiresOn = &date
+	}
+	return nil
+}
+
+func (c *PantryController) findPantryItem(r *http.Request) (models.PantryItem, error) {
+	var item models.PantryItem
+	err := c.DB.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.LoggedInUserID(r)).
+		First(&item).Error
+	return item, err
+}
+
+// expiringPantryItems returns userID's pantry items that expire in the next
+// expiringDays days or already have, soonest first.
+func expiringPantryItems(db *gorm.DB, userID uint) ([]models.PantryItem, error) {
+	now := time.Now()
+	cutoff := time.Date(now.Year(), now.Month(), now.Day()+expiringDays, 0, 0, 0, 0, time.UTC)
+	var items []models.PantryItem
+	err := db.Scopes(pantryOrder).
+		Where("user_id = ? AND expires_on <= ?", userID, cutoff).
+		Find(&items).Error
+	return items, err
+}
+
+// pantryOrder lists pantry items with the ones to use up first at the top.
+func pantryOrder(db *gorm.DB) *gorm.DB {
+	return db.Order("expires_on ASC NULLS LAST, name ASC")
+}
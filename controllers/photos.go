@@ -0,0 +1,231 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/securecookie"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/photos"
+	"github.com/imsteev/recipebook/policy"
+	"github.com/imsteev/recipebook/storage"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxPhotosPerUpload is how many photos one save of the recipe form
+	// may add.
+	maxPhotosPerUpload = 8
+	// maxRecipeFormSize bounds the whole recipe form, photos included.
+	maxRecipeFormSize = maxPhotosPerUpload*photos.MaxSize + 1<<20
+)
+
+// PhotoController serves recipe photos from the photo store. Photos aren't
+// under /static/ because who may see one depends on who may see its recipe.
+type PhotoController struct {
+	DB     *gorm.DB
+	Photos storage.Store
+}
+
+// GetPhoto serves a photo, or with /thumbnail its thumbnail, of a recipe the
+// user can see.
+func (c *PhotoController) GetPhoto(w http.ResponseWriter, r *http.Request) {
+	viewable := c.DB.Model(&models.Recipe{}).
+		Scopes(policy.ViewableRecipes(middleware.LoggedInUserID(r))).
+		Select("recipes.id")
+
+	var photo models.RecipePhoto
+	err := c.DB.Where("id = ? AND recipe_id IN (?)", mux.Vars(r)["id"], viewable).First(&photo).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	c.serve(w, r, photo)
+}
+
+// GetSharedPhoto serves a photo to a guest with a book's shared link. The
+// photo's recipe has to be in that book.
+func (c *PhotoController) GetSharedPhoto(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	var photo models.RecipePhoto
+	err := c.DB.Joins("JOIN recipe_book_recipes ON recipe_book_recipes.recipe_id = recipe_photos.recipe_id AND recipe_book_recipes.deleted_at IS NULL").
+		Joins("JOIN recipe_book_shared_links ON recipe_book_shared_links.recipe_book_id = recipe_book_recipes.recipe_book_id AND recipe_book_shared_links.deleted_at IS NULL").
+		Where("recipe_book_shared_links.slug = ? AND recipe_photos.id = ?", params["slug"], params["id"]).
+		First(&photo).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	c.serve(w, r, photo)
+}
+
+func (c *PhotoController) serve(w http.ResponseWriter, r *http.Request, photo models.RecipePhoto) {
+	key, contentType := photo.Key, photo.ContentType
+	if mux.Vars(r)["size"] == "thumbnail" {
+		key, contentType = photo.ThumbnailKey, "image/jpeg"
+	}
+
+	blob, err := c.Photos.Open(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	// Keys are random and never reused, so a photo never changes.
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	io.Copy(w, blob)
+}
+
+// parseRecipeForm parses the recipe form, which is multipart when it has
+// photos attached.
+func parseRecipeForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxRecipeFormSize)
+	err := r.ParseMultipartForm(32 << 20)
+	if errors.Is(err, http.ErrNotMultipart) {
+		return r.ParseForm()
+	}
+	return err
+}
+
+// uploadedPhotos checks the files in the form's "photos" field. Nothing is
+// stored yet, so a bad file rejects the form without leaving anything behind.
+func uploadedPhotos(r *http.Request) ([]photos.Photo, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+
+	var uploads []photos.Photo
+	for _, header := range r.MultipartForm.File["photos"] {
+		// An empty file input still sends a part with no name.
+		if header.Filename == "" && header.Size == 0 {
+			continue
+		}
+		if len(uploads) == maxPhotosPerUpload {
+			return nil, fmt.Errorf("you can add up to %d photos at a time", maxPhotosPerUpload)
+		}
+
+		f, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		photo, err := photos.Prepare(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", header.Filename, err)
+		}
+		uploads = append(uploads, photo)
+	}
+	return uploads, nil
+}
+
+// storePhotos puts uploads and their thumbnails in the photo store and
+// returns the rows to save for them, numbered from position. If anything
+// fails, what was already stored is removed again.
+func storePhotos(store storage.Store, uploads []photos.Photo, position int) ([]models.RecipePhoto, error) {
+	var stored []models.RecipePhoto
+	for i, upload := range uploads {
+		name := "photos/" + hex.EncodeToString(securecookie.GenerateRandomKey(16))
+		photo := models.RecipePhoto{
+			Position:     position + i,
+			Key:          name + upload.Ext,
+			ThumbnailKey: name + "-thumbnail.jpg",
+			ContentType:  upload.ContentType,
+			Width:        upload.Width,
+			Height:       upload.Height,
+		}
+
+		err := store.Put(photo.Key, bytes.NewReader(upload.Data))
+		if err == nil {
+			err = store.Put(photo.ThumbnailKey, bytes.NewReader(upload.Thumbnail))
+			if err != nil {
+				store.Delete(photo.Key)
+			}
+		}
+		if err != nil {
+			deletePhotoFiles(store, stored)
+			return nil, err
+		}
+		stored = append(stored, photo)
+	}
+	return stored, nil
+}
+
+// copyPhotoFiles stores copies of recipePhotos' files under new keys, so a
+// copied recipe's photos outlive the original's. Photos whose files have
+// gone missing are left out.
+func copyPhotoFiles(store storage.Store, recipePhotos []models.RecipePhoto) ([]models.RecipePhoto, error) {
+	var copied []models.RecipePhoto
+	for _, photo := range recipePhotos {
+		name := "photos/" + hex.EncodeToString(securecookie.GenerateRandomKey(16))
+		c := models.RecipePhoto{
+			Position:     photo.Position,
+			Key:          name + path.Ext(photo.Key),
+			ThumbnailKey: name + "-thumbnail.jpg",
+			ContentType:  photo.ContentType,
+			Width:        photo.Width,
+			Height:       photo.Height,
+		}
+
+		err := copyFile(store, photo.Key, c.Key)
+		if err == nil {
+			err = copyFile(store, photo.ThumbnailKey, c.ThumbnailKey)
+			if err != nil {
+				store.Delete(c.Key)
+			}
+		}
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			deletePhotoFiles(store, copied)
+			return nil, err
+		}
+		copied = append(copied, c)
+	}
+	return copied, nil
+}
+
+func copyFile(store storage.Store, from, to string) error {
+	blob, err := store.Open(from)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	return store.Put(to, blob)
+}
+
+// deletePhotoFiles removes photos from the store once their rows are gone.
+// A file that can't be deleted is only orphaned, so it's logged rather than
+// failing the request.
+func deletePhotoFiles(store storage.Store, recipePhotos []models.RecipePhoto) {
+	for _, photo := range recipePhotos {
+		for _, key := range []string{photo.Key, photo.ThumbnailKey} {
+			if err := store.Delete(key); err != nil {
+				log.Printf("failed to delete photo %d: %v", photo.ID, err)
+			}
+		}
+	}
+}
+
+// preloadPhotos loads a recipe's photos in order, so the first is its cover.
+func preloadPhotos(db *gorm.DB) *gorm.DB {
+	return db.Preload("Photos", func(db *gorm.DB) *gorm.DB {
+		return db.Order("recipe_photos.position ASC")
+	})
+}
@@ -1,32 +1,261 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/middleware"
 	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
 	"github.com/imsteev/recipebook/views"
 	"gorm.io/gorm"
 )
 
+const (
+	maxCommentLength     = 2000
+	maxCommentNameLength = 50
+	maxCommentLinks      = 2
+)
+
 type RecipeCommentsController struct {
 	DB     *gorm.DB
 	Engine *views.Engine
 }
 
+// CreateComment adds a comment, or a reply to one, from the logged in user on
+// a recipe they can see.
 func (c *RecipeCommentsController) CreateComment(w http.ResponseWriter, r *http.Request) {
-	recipeID, err := strconv.ParseUint(r.FormValue("recipe_id"), 10, 64)
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+	var recipe models.Recipe
+	err = c.DB.Scopes(policy.ViewableRecipes(userID)).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var user models.User
+	if err := c.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	comment := models.RecipeMessage{
+		RecipeID: recipe.ID,
+		UserID:   &user.ID,
+		From:     user.Username,
+		Message:  strings.TrimSpace(r.PostFormValue("message")),
+	}
+	if err := c.createComment(r, &comment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.renderComments(w, r, recipe, "")
+}
+
+// CreateGuestComment adds a comment from someone reading a recipe through a
+// recipe book's share link. Guests aren't logged in, so they give a name.
+func (c *RecipeCommentsController) CreateGuestComment(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slug := mux.Vars(r)["slug"]
+	_, recipe, err := findSharedRecipe(c.DB, slug, mux.Vars(r)["recipeID"])
 	if err != nil {
-		http.Error(w, "Invalid recipe ID", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+
 	comment := models.RecipeMessage{
-		From:     r.FormValue("from"),
-		RecipeID: uint(recipeID),
-		Message:  r.FormValue("message"),
+		RecipeID: recipe.ID,
+		From:     strings.TrimSpace(r.PostFormValue("from")),
+		Message:  strings.TrimSpace(r.PostFormValue("message")),
+	}
+	if err := c.createComment(r, &comment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.renderComments(w, r, recipe, slug)
+}
+
+// DeleteComment removes a comment and every reply under it. Only the
+// recipe's owner can delete comments.
+func (c *RecipeCommentsController) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	var recipe models.Recipe
+	err := c.DB.Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.LoggedInUserID(r)).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var comments []models.RecipeMessage
+	if err := c.DB.Where("recipe_id = ?", recipe.ID).Find(&comments).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	commentID, err := strconv.ParseUint(mux.Vars(r)["commentID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+	ids := threadIDs(comments, uint(commentID))
+	if len(ids) == 0 {
+		http.Error(w, gorm.ErrRecordNotFound.Error(), http.StatusNotFound)
+		return
 	}
 
-	c.DB.Create(&comment)
-	http.Redirect(w, r, fmt.Sprintf("/recipes/%d", recipeID), http.StatusSeeOther)
+	if err := c.DB.Delete(&models.RecipeMessage{}, ids).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderComments(w, r, recipe, "")
+}
+
+var errSpam = errors.New("comment rejected")
+
+// createComment validates comment, attaches it to the comment it replies to
+// (if any), and saves it.
+func (c *RecipeCommentsController) createComment(r *http.Request, comment *models.RecipeMessage) error {
+	// Real people don't see the "website" field; bots fill in every field
+	// they find.
+	if r.PostFormValue("website") != "" {
+		return errSpam
+	}
+	if comment.From == "" {
+		return errors.New("name is required")
+	}
+	if utf8.RuneCountInString(comment.From) > maxCommentNameLength {
+		return fmt.Errorf("name must be at most %d characters", maxCommentNameLength)
+	}
+	if comment.Message == "" {
+		return errors.New("comment can't be empty")
+	}
+	if utf8.RuneCountInString(comment.Message) > maxCommentLength {
+		return fmt.Errorf("comment must be at most %d characters", maxCommentLength)
+	}
+	message := strings.ToLower(comment.Message)
+	if strings.Count(message, "http://")+strings.Count(message, "https://") > maxCommentLinks {
+		return fmt.Errorf("comments can have at most %d links", maxCommentLinks)
+	}
+
+	if parentID := r.PostFormValue("parent_id"); parentID != "" {
+		var parent models.RecipeMessage
+		err := c.DB.Where("id = ? AND recipe_id = ?", parentID, comment.RecipeID).First(&parent).Error
+		if err != nil {
+			return errors.New("the comment you replied to no longer exists")
+		}
+		comment.ParentID = &parent.ID
+	}
+
+	return c.DB.Create(comment).Error
+}
+
+// commentThread is a comment with its replies, along with what the template
+// needs to render the reply and delete controls under it.
+type commentThread struct {
+	models.RecipeMessage
+	Replies   []commentThread
+	PostURL   string
+	Guest     bool
+	CanDelete bool
+}
+
+// renderComments renders the comments section of recipe. slug is the share
+// link the guest is reading through, or "" for logged in users.
+func (c *RecipeCommentsController) renderComments(w http.ResponseWriter, r *http.Request, recipe models.Recipe, slug string) {
+	data, err := commentsData(c.DB, r, recipe, slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = c.Engine.RenderPartial(w, "comments.html", "recipe-comments", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// commentsData loads the comment threads on recipe for the "recipe-comments"
+// template. Pages that embed the template merge it into their own data.
+func commentsData(db *gorm.DB, r *http.Request, recipe models.Recipe, slug string) (map[string]any, error) {
+	var comments []models.RecipeMessage
+	err := db.Where("recipe_id = ?", recipe.ID).Order("created_at ASC").Find(&comments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	thread := commentThread{
+		PostURL: fmt.Sprintf("/recipes/%d/comments", recipe.ID),
+		Guest:   slug != "",
+	}
+	if thread.Guest {
+		thread.PostURL = fmt.Sprintf("/recipebooks/slug/%s/recipes/%d/comments", slug, recipe.ID)
+	} else {
+		thread.CanDelete = recipe.UserID == middleware.LoggedInUserID(r)
+	}
+
+	return map[string]any{
+		"Comments":  threads(comments, nil, thread),
+		"PostURL":   thread.PostURL,
+		"Guest":     thread.Guest,
+		"csrfToken": csrf.Token(r),
+	}, nil
+}
+
+// threads builds the replies to parentID (the top level comments when it's
+// nil), copying the URLs and permissions from tmpl onto each.
+func threads(comments []models.RecipeMessage, parentID *uint, tmpl commentThread) []commentThread {
+	var result []commentThread
+	for _, comment := range comments {
+		if (parentID == nil) != (comment.ParentID == nil) || (parentID != nil && *parentID != *comment.ParentID) {
+			continue
+		}
+		thread := tmpl
+		thread.RecipeMessage = comment
+		thread.Replies = threads(comments, &comment.ID, tmpl)
+		result = append(result, thread)
+	}
+	return result
+}
+
+// threadIDs returns the ID of comment id and of every reply under it, or nil
+// if there is no such comment.
+func threadIDs(comments []models.RecipeMessage, id uint) []uint {
+	found := false
+	for _, comment := range comments {
+		if comment.ID == id {
+			found = true
+		}
+	}
+	if !found {
+		return nil
+	}
+	ids := []uint{id}
+	for _, comment := range comments {
+		if comment.ParentID != nil && *comment.ParentID == id {
+			ids = append(ids, threadIDs(comments, comment.ID)...)
+		}
+	}
+	return ids
 }
@@ -3,6 +3,9 @@ package controllers
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
@@ -10,6 +13,7 @@ import (
 	"github.com/gorilla/sessions"
 	"github.com/imsteev/recipebook/middleware"
 	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
 	"github.com/imsteev/recipebook/views"
 	"gorm.io/gorm"
 )
@@ -35,7 +39,7 @@ func (c *RecipebookController) CreateRecipeBook(w http.ResponseWriter, r *http.R
 
 	recipebook := models.RecipeBook{
 		Name:      r.FormValue("name"),
-		CreatedBy: r.Context().Value(middleware.LoggedInUserCtxKey{}).(uint),
+		CreatedBy: middleware.LoggedInUserID(r),
 	}
 	c.DB.Create(&recipebook)
 	w.Header().Add("HX-Redirect", fmt.Sprintf("/recipebooks/%d", recipebook.ID))
@@ -44,8 +48,18 @@ func (c *RecipebookController) CreateRecipeBook(w http.ResponseWriter, r *http.R
 
 func (c *RecipebookController) ListRecipebooks(w http.ResponseWriter, r *http.Request) {
 	var recipebooks []models.RecipeBook
-	fmt.Println(r.Context().Value(middleware.LoggedInUserCtxKey{}))
-	err := c.DB.Find(&recipebooks).Where("created_by = ?", r.Context().Value(middleware.LoggedInUserCtxKey{}).(uint)).Error
+	err := c.DB.Scopes(policy.ViewableRecipeBooks(middleware.LoggedInUserID(r))).
+		Order("name ASC").
+		Find(&recipebooks).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var gifts []models.RecipeBookGift
+	err = c.DB.Preload("RecipeBook").Preload("FromUser").
+		Where("to_user_id = ? AND status = ?", middleware.LoggedInUserID(r), models.GiftPending).
+		Order("created_at DESC").
+		Find(&gifts).Error
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -53,6 +67,8 @@ func (c *RecipebookController) ListRecipebooks(w http.ResponseWriter, r *http.Re
 	c.Engine.Render(w, "recipebooks-list.html", map[string]interface{}{
 		csrf.TemplateTag: csrf.TemplateField(r),
 		"RecipeBooks":    recipebooks,
+		"Gifts":          gifts,
+		"UserID":         middleware.LoggedInUserID(r),
 	})
 }
 
@@ -60,22 +76,83 @@ func (c *RecipebookController) GetRecipeBook(w http.ResponseWriter, r *http.Requ
 	params := mux.Vars(r)
 	recipeBookId := params["id"]
 
+	userID := middleware.LoggedInUserID(r)
 	var recipebook models.RecipeBook
-	err := c.DB.Where("id = ?", recipeBookId).First(&recipebook).Error
+	err := c.DB.Scopes(policy.ViewableRecipeBooks(userID), preloadBookRecipes).
+		Where("recipe_books.id = ?", recipeBookId).
+		First(&recipebook).Error
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := inheritParents(c.DB, bookRecipes(recipebook)...); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	role, err := policy.RoleIn(c.DB, recipebook, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var available []models.Recipe
+	if role != models.RoleViewer {
+		available, err = c.recipesNotInBook(recipebook, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	var members []models.RecipeBookMember
+	if role == models.RoleOwner {
+		members, err = c.members(recipebook.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 	var sharedLink models.RecipeBookSharedLink
 	err = c.DB.Where("recipe_book_id = ?", recipebook.ID).First(&sharedLink).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	var pendingGift models.RecipeBookGift
+	if recipebook.CreatedBy == userID {
+		err = c.DB.Where("recipe_book_id = ? AND status = ?", recipebook.ID, models.GiftPending).
+			Order("created_at DESC").Limit(1).Find(&pendingGift).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	giftMessage, err := c.unseenGiftMessage(recipebook.ID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var transfers []models.RecipeBookTransfer
+	err = c.DB.Preload("FromUser").Preload("ToUser").
+		Where("recipe_book_id = ?", recipebook.ID).
+		Order("created_at ASC").
+		Find(&transfers).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	c.Engine.Render(w, "recipebooks-show.html", map[string]interface{}{
 		csrf.TemplateTag: csrf.TemplateField(r),
+		"csrfToken":      csrf.Token(r),
 		"RecipeBook":     recipebook,
+		"CanGift":        recipebook.CreatedBy == userID,
+		"PendingGift":    pendingGift,
+		"GiftMessage":    giftMessage,
+		"Transfers":      transfers,
+		"Available":      available,
 		"SharedLink":     sharedLink,
+		"Role":           role,
+		"CanEdit":        role != models.RoleViewer,
+		"Members":        members,
+		"Roles":          []models.Role{models.RoleViewer, models.RoleEditor, models.RoleOwner},
 	})
 }
 
@@ -84,9 +161,11 @@ func (c *RecipebookController) CreateRecipeBookSharedLink(w http.ResponseWriter,
 	recipeBookId := params["id"]
 
 	var recipebook models.RecipeBook
-	err := c.DB.Where("id = ?", recipeBookId).First(&recipebook).Error
+	err := c.DB.Scopes(policy.OwnedRecipeBooks(middleware.LoggedInUserID(r))).
+		Where("recipe_books.id = ?", recipeBookId).
+		First(&recipebook).Error
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
@@ -101,8 +180,7 @@ func (c *RecipebookController) CreateRecipeBookSharedLink(w http.ResponseWriter,
 		return
 	}
 
-	fmt.Println(sharedLink)
-	w.Write([]byte(fmt.Sprintf(`<a href="/recipebooks/%s">%s</a>`, sharedLink.Slug, "Public Link")))
+	w.Write([]byte(fmt.Sprintf(`<a href="/recipebooks/slug/%s">%s</a>`, sharedLink.Slug, "Public Link")))
 }
 
 func (c *RecipebookController) GetRecipeBookBySlug(w http.ResponseWriter, r *http.Request) {
@@ -116,17 +194,426 @@ func (c *RecipebookController) GetRecipeBookBySlug(w http.ResponseWriter, r *htt
 	}
 
 	var recipebook models.RecipeBook
-	if err := c.DB.Where("id = ?", sharedLink.RecipeBookID).First(&recipebook).Error; err != nil {
+	err := c.DB.Scopes(preloadBookRecipes).Preload("Recipes.Recipe.Tags").
+		Where("id = ?", sharedLink.RecipeBookID).
+		First(&recipebook).Error
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if err := inheritParents(c.DB, bookRecipes(recipebook)...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	err := c.Engine.Render(w, "recipebooks-guest.html", map[string]interface{}{
+	// Books are small enough to filter by tag here rather than in SQL.
+	tags := activeTags(r)
+	recipes := make([]models.Recipe, len(recipebook.Recipes))
+	var entries []models.RecipeBookRecipe
+	for i, entry := range recipebook.Recipes {
+		recipes[i] = entry.Recipe
+		if hasTags(entry.Recipe.Tags, tags) {
+			entries = append(entries, entry)
+		}
+	}
+
+	err = c.Engine.Render(w, "recipebooks-guest.html", map[string]interface{}{
 		csrf.TemplateTag: csrf.TemplateField(r),
 		"RecipeBook":     recipebook,
+		"Entries":        entries,
+		"TagFilters":     tagFilters(r, uniqueTags(recipes), tags),
+		"Tags":           tags,
+		"Slug":           slug,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetSharedRecipe shows a recipe to a guest who has the book's shared link.
+// The recipe has to be in that book.
+func (c *RecipebookController) GetSharedRecipe(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	slug := params["slug"]
+
+	recipebook, recipe, err := findSharedRecipe(c.DB, slug, params["recipeID"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	data, err := commentsData(c.DB, r, recipe, slug)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data[csrf.TemplateTag] = csrf.TemplateField(r)
+	data["RecipeBook"] = recipebook
+	data["Recipe"] = recipe
+	data["Slug"] = slug
+
+	// Readers who are logged in can save a copy of the recipe, or go to the
+	// one they saved already.
+	sesh, err := c.Store.Get(r, "sesh")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if userID, ok := sesh.Values["loggedInUserID"].(uint); ok {
+		data["LoggedIn"] = true
+		data["OwnRecipe"] = recipe.UserID == userID
+		var copies []models.Recipe
+		err = c.DB.Where("user_id = ? AND forked_from_id = ?", userID, recipe.ID).
+			Order("created_at DESC").Limit(1).
+			Find(&copies).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(copies) > 0 {
+			data["Copy"] = copies[0]
+		}
+	}
+
+	err = c.Engine.Render(w, "recipes-guest.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// findSharedRecipe loads a recipe, with its ingredients and steps, from the
+// recipe book shared under slug. A variant comes with what it inherits.
+func findSharedRecipe(db *gorm.DB, slug string, recipeID string) (models.RecipeBook, models.Recipe, error) {
+	var (
+		sharedLink models.RecipeBookSharedLink
+		recipebook models.RecipeBook
+		recipe     models.Recipe
+	)
+	if err := db.Where("slug = ?", slug).First(&sharedLink).Error; err != nil {
+		return recipebook, recipe, err
+	}
+	if err := db.Where("id = ?", sharedLink.RecipeBookID).First(&recipebook).Error; err != nil {
+		return recipebook, recipe, err
+	}
+	err := db.Scopes(preloadIngredients, preloadSteps, preloadTags, preloadPhotos).
+		Joins("JOIN recipe_book_recipes ON recipe_book_recipes.recipe_id = recipes.id AND recipe_book_recipes.deleted_at IS NULL").
+		Where("recipe_book_recipes.recipe_book_id = ? AND recipes.id = ?", recipebook.ID, recipeID).
+		First(&recipe).Error
+	if err != nil {
+		return recipebook, recipe, err
+	}
+	_, err = inheritParent(db, &recipe)
+	return recipebook, recipe, err
+}
+
+// AddRecipe puts one of the user's recipes at the end of the book.
+func (c *RecipebookController) AddRecipe(w http.ResponseWriter, r *http.Request) {
+	recipebook, err := c.findEditableRecipeBook(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var recipe models.Recipe
+	err = c.DB.Where("recipes.id = ? AND recipes.user_id = ?", r.FormValue("recipe_id"), middleware.LoggedInUserID(r)).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var count int64
+	err = c.DB.Model(&models.RecipeBookRecipe{}).
+		Where("recipe_book_id = ? AND recipe_id = ?", recipebook.ID, recipe.ID).
+		Count(&count).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if count == 0 {
+		entry := models.RecipeBookRecipe{
+			RecipeBookID: recipebook.ID,
+			RecipeID:     recipe.ID,
+			Position:     len(recipebook.Recipes),
+		}
+		if err := c.DB.Create(&entry).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	c.renderBookRecipes(w, r, recipebook.ID)
+}
+
+func (c *RecipebookController) RemoveRecipe(w http.ResponseWriter, r *http.Request) {
+	recipebook, err := c.findEditableRecipeBook(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("recipe_book_id = ? AND recipe_id = ?", recipebook.ID, mux.Vars(r)["recipeID"]).
+			Delete(&models.RecipeBookRecipe{}).Error
+		if err != nil {
+			return err
+		}
+		return renumberBookRecipes(tx, recipebook.ID)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderBookRecipes(w, r, recipebook.ID)
+}
+
+// MoveRecipe moves a recipe one place up or down in the book.
+func (c *RecipebookController) MoveRecipe(w http.ResponseWriter, r *http.Request) {
+	recipebook, err := c.findEditableRecipeBook(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	recipeID, err := strconv.ParseUint(mux.Vars(r)["recipeID"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid recipe ID", http.StatusBadRequest)
+		return
+	}
+
+	var offset int
+	switch r.FormValue("direction") {
+	case "up":
+		offset = -1
+	case "down":
+		offset = 1
+	default:
+		http.Error(w, "direction must be up or down", http.StatusBadRequest)
+		return
+	}
+
+	entries := recipebook.Recipes
+	for i, entry := range entries {
+		if entry.RecipeID != uint(recipeID) {
+			continue
+		}
+		j := i + offset
+		if j < 0 || j >= len(entries) {
+			break
+		}
+		entries[i], entries[j] = entries[j], entries[i]
+		err := c.DB.Transaction(func(tx *gorm.DB) error {
+			for pos, entry := range entries {
+				if err := tx.Model(&entry).Update("position", pos).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		break
+	}
+
+	c.renderBookRecipes(w, r, recipebook.ID)
+}
+
+// AddMember invites another user to the book by username, or changes their
+// role if they're already a member.
+func (c *RecipebookController) AddMember(w http.ResponseWriter, r *http.Request) {
+	recipebook, err := c.findOwnedRecipeBook(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	role := models.Role(r.FormValue("role"))
+	if role != models.RoleOwner && role != models.RoleEditor && role != models.RoleViewer {
+		http.Error(w, "Unknown role", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := c.DB.Where("username = ?", strings.TrimSpace(r.FormValue("username"))).First(&user).Error; err != nil {
+		http.Error(w, "No user with that username", http.StatusNotFound)
+		return
+	}
+	if user.ID == recipebook.CreatedBy {
+		http.Error(w, "That user already owns this book", http.StatusBadRequest)
+		return
+	}
+
+	var member models.RecipeBookMember
+	err = c.DB.Where(models.RecipeBookMember{RecipeBookID: recipebook.ID, UserID: user.ID}).
+		Assign(models.RecipeBookMember{Role: role}).
+		FirstOrCreate(&member).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderMembers(w, recipebook.ID)
+}
+
+func (c *RecipebookController) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	recipebook, err := c.findOwnedRecipeBook(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	err = c.DB.Where("id = ? AND recipe_book_id = ?", mux.Vars(r)["memberID"], recipebook.ID).
+		Delete(&models.RecipeBookMember{}).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	c.renderMembers(w, recipebook.ID)
+}
+
+func (c *RecipebookController) members(recipeBookID uint) ([]models.RecipeBookMember, error) {
+	var members []models.RecipeBookMember
+	err := c.DB.Preload("User").Where("recipe_book_id = ?", recipeBookID).Order("created_at ASC").Find(&members).Error
+	return members, err
+}
+
+// renderMembers re-renders the book's member list for htmx to swap in.
+func (c *RecipebookController) renderMembers(w http.ResponseWriter, recipeBookID uint) {
+	members, err := c.members(recipeBookID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.RenderPartial(w, "recipebooks-show.html", "book-members", map[string]interface{}{
+		"RecipeBook": models.RecipeBook{Model: gorm.Model{ID: recipeBookID}},
+		"Members":    members,
+		"Roles":      []models.Role{models.RoleViewer, models.RoleEditor, models.RoleOwner},
 	})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
+
+// unseenGiftMessage returns the gift userID accepted for the book if they
+// haven't opened the book since, and marks it seen so the message is only
+// shown once.
+func (c *RecipebookController) unseenGiftMessage(recipeBookID, userID uint) (*models.RecipeBookGift, error) {
+	var gifts []models.RecipeBookGift
+	err := c.DB.Preload("FromUser").
+		Where("recipe_book_id = ? AND to_user_id = ? AND status = ? AND message_seen_at IS NULL", recipeBookID, userID, models.GiftAccepted).
+		Limit(1).
+		Find(&gifts).Error
+	if err != nil || len(gifts) == 0 {
+		return nil, err
+	}
+	if err := c.DB.Model(&gifts[0]).Update("message_seen_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return &gifts[0], nil
+}
+
+// findOwnedRecipeBook loads the book named by the {id} route variable if the
+// logged in user owns it.
+func (c *RecipebookController) findOwnedRecipeBook(r *http.Request) (models.RecipeBook, error) {
+	var recipebook models.RecipeBook
+	err := c.DB.Scopes(policy.OwnedRecipeBooks(middleware.LoggedInUserID(r))).
+		Where("recipe_books.id = ?", mux.Vars(r)["id"]).
+		First(&recipebook).Error
+	return recipebook, err
+}
+
+// findEditableRecipeBook loads the book named by the {id} route variable,
+// with its recipes, if the logged in user may change it.
+func (c *RecipebookController) findEditableRecipeBook(r *http.Request) (models.RecipeBook, error) {
+	var recipebook models.RecipeBook
+	err := c.DB.Scopes(policy.EditableRecipeBooks(middleware.LoggedInUserID(r)), preloadBookRecipes).
+		Where("recipe_books.id = ?", mux.Vars(r)["id"]).
+		First(&recipebook).Error
+	return recipebook, err
+}
+
+// recipesNotInBook lists the user's recipes that could still be added to
+// the book.
+func (c *RecipebookController) recipesNotInBook(recipebook models.RecipeBook, userID uint) ([]models.Recipe, error) {
+	var recipes []models.Recipe
+	err := c.DB.Where("recipes.user_id = ?", userID).
+		Where("id NOT IN (?)", c.DB.Model(&models.RecipeBookRecipe{}).Select("recipe_id").Where("recipe_book_id = ?", recipebook.ID)).
+		Find(&recipes).Error
+	if err == nil {
+		err = inheritParents(c.DB, eachRecipe(recipes)...)
+	}
+	sortRecipes(recipes)
+	return recipes, err
+}
+
+// renderBookRecipes re-renders the book's recipe list for htmx to swap in.
+func (c *RecipebookController) renderBookRecipes(w http.ResponseWriter, r *http.Request, recipeBookID uint) {
+	var recipebook models.RecipeBook
+	if err := c.DB.Scopes(preloadBookRecipes).First(&recipebook, recipeBookID).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := inheritParents(c.DB, bookRecipes(recipebook)...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	available, err := c.recipesNotInBook(recipebook, middleware.LoggedInUserID(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.RenderPartial(w, "recipebooks-show.html", "book-recipes", map[string]interface{}{
+		"RecipeBook": recipebook,
+		"Available":  available,
+		"CanEdit":    true,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// renumberBookRecipes closes the gaps in a book's positions after a recipe
+// is removed.
+func renumberBookRecipes(tx *gorm.DB, recipeBookID uint) error {
+	var entries []models.RecipeBookRecipe
+	if err := tx.Where("recipe_book_id = ?", recipeBookID).Order("position ASC").Find(&entries).Error; err != nil {
+		return err
+	}
+	for pos, entry := range entries {
+		if entry.Position == pos {
+			continue
+		}
+		if err := tx.Model(&entry).Update("position", pos).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bookRecipes points at each recipe in a book, for inheritParents.
+func bookRecipes(recipebook models.RecipeBook) []*models.Recipe {
+	recipes := make([]*models.Recipe, len(recipebook.Recipes))
+	for i := range recipebook.Recipes {
+		recipes[i] = &recipebook.Recipes[i].Recipe
+	}
+	return recipes
+}
+
+// preloadBookRecipes loads a book's recipes in the book's order.
+func preloadBookRecipes(db *gorm.DB) *gorm.DB {
+	return db.Preload("Recipes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("recipe_book_recipes.position ASC")
+	}).Preload("Recipes.Recipe").Preload("Recipes.Recipe.Photos", func(db *gorm.DB) *gorm.DB {
+		return db.Order("recipe_photos.position ASC")
+	})
+}
@@ -1,30 +1,44 @@
 package controllers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/csrf"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
+	"github.com/imsteev/recipebook/catalog"
 	"github.com/imsteev/recipebook/middleware"
 	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/nutrition"
+	"github.com/imsteev/recipebook/policy"
+	"github.com/imsteev/recipebook/quantity"
+	"github.com/imsteev/recipebook/search"
+	"github.com/imsteev/recipebook/storage"
+	"github.com/imsteev/recipebook/units"
 	"github.com/imsteev/recipebook/views"
 	"gorm.io/gorm"
 )
 
 type RecipeController struct {
-	DB     *gorm.DB
-	Engine *views.Engine
-	Store  *sessions.CookieStore
+	DB        *gorm.DB
+	Engine    *views.Engine
+	Store     *sessions.CookieStore
+	Photos    storage.Store
+	Nutrients *nutrition.Table
 }
 
 func (c *RecipeController) NewRecipe(w http.ResponseWriter, r *http.Request) {
 	err := c.Engine.Render(w, "recipes-form.html", map[string]any{
 		"Title":          "New Recipe",
 		"Action":         "/recipes",
-		"Recipe":         models.Recipe{},
+		"Recipe":         models.Recipe{Steps: []models.RecipeStep{{}}}, // a blank step to start with
+		"TagKinds":       models.TagKinds,
+		"TagFields":      tagFields(nil),
 		csrf.TemplateTag: csrf.TemplateField(r),
 	})
 
@@ -35,34 +49,50 @@ func (c *RecipeController) NewRecipe(w http.ResponseWriter, r *http.Request) {
 }
 
 func (c *RecipeController) CreateRecipe(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseForm()
+	err := parseRecipeForm(w, r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var (
-		name         = r.PostFormValue("name")
-		description  = r.PostFormValue("description")
-		instructions = r.PostFormValue("instructions")
-	)
-
-	if name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+	recipe := models.Recipe{UserID: middleware.LoggedInUserID(r)}
+	steps, err := readRecipeForm(&recipe, r.PostForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	ingredients := c.ParseIngredients(r.PostForm["ingredients"], r.PostForm["quantities"])
-
-	recipe := models.Recipe{
-		Name:         name,
-		Description:  description,
-		Ingredients:  ingredients,
-		Instructions: instructions,
-		UserID:       uint(r.Context().Value(middleware.LoggedInUserCtxKey{}).(uint)),
+	uploads, err := uploadedPhotos(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	recipePhotos, err := storePhotos(c.Photos, uploads, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recipe.Photos = recipePhotos
 
-	if err := c.DB.Create(&recipe).Error; err != nil {
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		ingredients, err := parseIngredients(tx, r.PostForm["ingredients"], r.PostForm["quantities"])
+		if err != nil {
+			return err
+		}
+		recipe.Ingredients = ingredients
+		linkStepIngredients(steps, ingredients)
+		recipe.Steps = steps
+		recipe.Tags, err = parseTags(tx, r.PostForm)
+		if err != nil {
+			return err
+		}
+		if err := tx.Create(&recipe).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, models.NewRevision(recipe, recipe.UserID))
+	})
+	if err != nil {
+		deletePhotoFiles(c.Photos, recipePhotos)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -70,11 +100,60 @@ func (c *RecipeController) CreateRecipe(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, fmt.Sprintf("/recipes/%d", recipe.ID), http.StatusSeeOther)
 }
 
+// ListRecipes lists the recipes the user can see, or with ?q= searches them.
+// The search box asks for just the results as the user types.
 func (c *RecipeController) ListRecipes(w http.ResponseWriter, r *http.Request) {
-	var recipes []models.Recipe
-	c.DB.Find(&recipes).Order("updated_at DESC")
+	userID := middleware.LoggedInUserID(r)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	tags := activeTags(r)
+
+	data := map[string]any{"Query": query, "Tags": tags}
+	if query != "" {
+		var hits []search.Hit
+		err := c.DB.Model(&models.Recipe{}).
+			Scopes(policy.ViewableRecipes(userID), taggedWith(tags), search.Recipes(query)).
+			Find(&hits).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data["Hits"] = hits
+	} else {
+		var recipes []models.Recipe
+		err := c.DB.Scopes(policy.ViewableRecipes(userID), taggedWith(tags), preloadTags, preloadPhotos).
+			Order("updated_at DESC").
+			Find(&recipes).Error
+		if err == nil {
+			err = inheritParents(c.DB, eachRecipe(recipes)...)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data["Recipes"] = recipes
+	}
 
-	err := c.Engine.Render(w, "recipes-list.html", recipes)
+	var err error
+	if r.Header.Get("HX-Target") == "recipe-results" {
+		err = c.Engine.RenderPartial(w, "recipes-list.html", "recipe-results", data)
+	} else {
+		data["Expiring"], err = expiringPantryItems(c.DB, userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var available []models.Tag
+		err = c.DB.Where("id IN (?)", c.DB.Table("recipe_tags").Select("tag_id").Where("recipe_id IN (?)",
+			c.DB.Model(&models.Recipe{}).Scopes(policy.ViewableRecipes(userID)).Select("recipes.id"))).
+			Find(&available).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		sortTags(available)
+		data["TagFilters"] = tagFilters(r, available, tags)
+		err = c.Engine.Render(w, "recipes-list.html", data)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -86,36 +165,224 @@ func (c *RecipeController) GetRecipe(w http.ResponseWriter, r *http.Request) {
 	recipeID := params["id"]
 
 	var recipe models.Recipe
-	if err := c.DB.Preload("Ingredients", func(db *gorm.DB) *gorm.DB {
-		return db.Order("ingredients.name ASC")
-	}).First(&recipe, recipeID).Error; err != nil {
+	err := c.DB.Scopes(policy.ViewableRecipes(middleware.LoggedInUserID(r)), preloadIngredients, preloadSteps, preloadTags, preloadPhotos).
+		Where("recipes.id = ?", recipeID).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	parent, err := inheritParent(c.DB, &recipe)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	servings, scale, err := requestedServings(r, recipe)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := c.DB.First(&user, middleware.LoggedInUserID(r)).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var editable int64
+	err = c.DB.Model(&models.Recipe{}).
+		Scopes(policy.EditableRecipes(user.ID)).
+		Where("recipes.id = ?", recipe.ID).
+		Count(&editable).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := commentsData(c.DB, r, recipe, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data["Recipe"] = recipe
+	data["Servings"] = servings
+	data["Scaled"] = scale != 1
+	data["Ingredients"] = ingredientLines(recipe.Ingredients, scale, user)
+	data["Nutrition"] = c.Nutrients.Estimate(recipe)
+	data["User"] = user
+	data["CanEdit"] = editable > 0
+	var cooked []models.CookedRecipe
+	err = c.DB.Where("user_id = ? AND recipe_id = ?", user.ID, recipe.ID).
+		Order("created_at DESC").Limit(1).
+		Find(&cooked).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(cooked) > 0 {
+		data["LastCooked"] = &cooked[0]
+	}
+	if recipe.ForkedFromID != nil {
+		data["ForkedFrom"], err = forkedFrom(c.DB, *recipe.ForkedFromID, user.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	data["Family"], err = findVariantFamily(c.DB, recipe, parent, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data[csrf.TemplateTag] = csrf.TemplateField(r)
+
+	err = c.Engine.Render(w, "recipes-show.html", data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// CookRecipe is cook mode: a recipe's steps one at a time in large type, to
+// follow along in the kitchen, beside its ingredients to tick off. ?step=
+// picks the step, counting from 1; the buttons between steps ask for just
+// the step.
+func (c *RecipeController) CookRecipe(w http.ResponseWriter, r *http.Request) {
+	var recipe models.Recipe
+	err := c.DB.Scopes(policy.ViewableRecipes(middleware.LoggedInUserID(r)), preloadIngredients, preloadSteps).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if _, err := inheritParent(c.DB, &recipe); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	err := c.Engine.Render(w, "recipes-show.html", recipe)
+	servings, scale, err := requestedServings(r, recipe)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := c.DB.First(&user, middleware.LoggedInUserID(r)).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	number := 1
+	if v := r.URL.Query().Get("step"); v != "" {
+		number, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "step must be a number", http.StatusBadRequest)
+			return
+		}
+	}
+	number = max(1, min(number, len(recipe.Steps)))
+
+	stepURL := func(n int) string {
+		u := fmt.Sprintf("/recipes/%d/cook?step=%d", recipe.ID, n)
+		if scale != 1 {
+			u += fmt.Sprintf("&servings=%d", servings)
+		}
+		return u
+	}
+
+	data := map[string]any{
+		"Recipe":      recipe,
+		"Servings":    servings,
+		"Scaled":      scale != 1,
+		"Ingredients": ingredientLines(recipe.Ingredients, scale, user),
+		"Number":      number,
+		"Count":       len(recipe.Steps),
+	}
+	if len(recipe.Steps) > 0 {
+		step := recipe.Steps[number-1]
+		data["Step"] = step
+		data["StepIngredients"] = ingredientLines(recipe.StepIngredients(step), scale, user)
+	}
+	if number > 1 {
+		data["PreviousURL"] = stepURL(number - 1)
+	}
+	if number < len(recipe.Steps) {
+		data["NextURL"] = stepURL(number + 1)
+	}
+
+	if r.Header.Get("HX-Target") == "cook-step" {
+		err = c.Engine.RenderPartial(w, "recipes-cook.html", "cook-step", data)
+	} else {
+		err = c.Engine.Render(w, "recipes-cook.html", data)
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+// requestedServings reads the ?servings= a recipe's page asks for, returning
+// how many it's for and how much its quantities scale by. Without one, it's
+// the recipe as written.
+func requestedServings(r *http.Request, recipe models.Recipe) (int, float64, error) {
+	v := r.URL.Query().Get("servings")
+	if v == "" {
+		return recipe.Servings, 1, nil
+	}
+	requested, err := parseServings(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	if recipe.Servings == 0 {
+		return 0, 0, errors.New("recipe doesn't say how many it serves, so it can't be scaled")
+	}
+	if requested == 0 {
+		return recipe.Servings, 1, nil
+	}
+	return requested, float64(requested) / float64(recipe.Servings), nil
+}
+
+// ingredientLines lays out ingredients for viewer, scaled by scale.
+func ingredientLines(ingredients []models.RecipeIngredient, scale float64, viewer models.User) []ingredientLine {
+	lines := make([]ingredientLine, len(ingredients))
+	for i, ri := range ingredients {
+		lines[i] = ingredientLine{Name: ri.DisplayName(), Quantity: displayQuantity(ri, scale, viewer)}
+	}
+	return lines
+}
+
 func (c *RecipeController) EditRecipe(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	recipeID := params["id"]
 
 	var recipe models.Recipe
-	if err := c.DB.Preload("Ingredients", func(db *gorm.DB) *gorm.DB {
-		return db.Order("ingredients.name ASC")
-	}).First(&recipe, recipeID).Error; err != nil {
+	err := c.DB.Scopes(policy.EditableRecipes(middleware.LoggedInUserID(r)), preloadIngredients, preloadSteps, preloadPhotos).
+		Preload("Tags").
+		Where("recipes.id = ?", recipeID).
+		First(&recipe).Error
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	// A variant is edited as it reads, but only its own photos can be
+	// removed from it.
+	photos := recipe.Photos
+	parent, err := inheritParent(c.DB, &recipe)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recipe.Photos = photos
 
-	err := c.Engine.Render(w, "recipe-form.html", map[string]any{
+	err = c.Engine.Render(w, "recipes-form.html", map[string]any{
 		"Title":          "Edit Recipe",
 		"Action":         fmt.Sprintf("/recipes/%s/edit", recipeID),
 		"Recipe":         recipe,
+		"Parent":         parent,
+		"TagKinds":       models.TagKinds,
+		"TagFields":      tagFields(recipe.Tags),
 		csrf.TemplateTag: csrf.TemplateField(r),
 	})
 	if err != nil {
@@ -126,9 +393,9 @@ func (c *RecipeController) EditRecipe(w http.ResponseWriter, r *http.Request) {
 
 func (c *RecipeController) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
 
-	err := r.ParseForm()
+	err := parseRecipeForm(w, r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -136,61 +403,285 @@ func (c *RecipeController) UpdateRecipe(w http.ResponseWriter, r *http.Request)
 	recipeID := params["id"]
 
 	var recipe models.Recipe
-	if err := c.DB.First(&recipe, recipeID).Error; err != nil {
+	err = c.DB.Scopes(policy.EditableRecipes(middleware.LoggedInUserID(r))).
+		Where("recipes.id = ?", recipeID).
+		First(&recipe).Error
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
+		return
 	}
-	// Delete all existing ingredients and recipe_ingredients for this recipe
-	if err := c.DB.Model(&recipe).Association("Ingredients").Clear(); err != nil {
-		http.Error(w, "Failed to clear existing ingredients: "+err.Error(), http.StatusInternalServerError)
+
+	steps, err := readRecipeForm(&recipe, r.PostForm)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Delete all recipe_ingredients for this recipe
-	if err := c.DB.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{}).Error; err != nil {
-		http.Error(w, "Failed to delete recipe_ingredients: "+err.Error(), http.StatusInternalServerError)
+	uploads, err := uploadedPhotos(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var position int
+	err = c.DB.Model(&models.RecipePhoto{}).
+		Where("recipe_id = ?", recipe.ID).
+		Select("COALESCE(MAX(position) + 1, 0)").
+		Scan(&position).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	added, err := storePhotos(c.Photos, uploads, position)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	var (
-		name         = r.PostFormValue("name")
-		description  = r.PostFormValue("description")
-		instructions = r.PostFormValue("instructions")
-	)
+	var removed []models.RecipePhoto
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := recordFirstRevision(tx, recipe.ID); err != nil {
+			return err
+		}
 
-	ingredients := c.ParseIngredients(r.PostForm["ingredients"], r.PostForm["quantities"])
+		if ids := r.PostForm["delete_photos"]; len(ids) > 0 {
+			if err := tx.Where("recipe_id = ? AND id IN ?", recipe.ID, ids).Find(&removed).Error; err != nil {
+				return err
+			}
+			if len(removed) > 0 {
+				if err := tx.Delete(&removed).Error; err != nil {
+					return fmt.Errorf("failed to delete photos: %w", err)
+				}
+			}
+		}
+		for i := range added {
+			added[i].RecipeID = recipe.ID
+		}
+		if len(added) > 0 {
+			if err := tx.Create(&added).Error; err != nil {
+				return fmt.Errorf("failed to save photos: %w", err)
+			}
+		}
 
-	if name == "" {
-		http.Error(w, "Name is required", http.StatusBadRequest)
+		if err := saveRecipeForm(tx, &recipe, r.PostForm, steps); err != nil {
+			return err
+		}
+		return recordRevision(tx, models.NewRevision(recipe, middleware.LoggedInUserID(r)))
+	})
+	if err != nil {
+		deletePhotoFiles(c.Photos, added)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	deletePhotoFiles(c.Photos, removed)
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/recipes/%s", recipeID))
+}
+
+// readRecipeForm sets recipe's fields from the recipe form, returning the
+// steps it has, which are saved along with the ingredients. Its errors are
+// the user's to fix.
+func readRecipeForm(recipe *models.Recipe, form url.Values) ([]models.RecipeStep, error) {
+	name := form.Get("name")
+	if name == "" {
+		return nil, errors.New("Name is required")
+	}
+
+	servings, err := parseServings(form.Get("servings"))
+	if err != nil {
+		return nil, err
+	}
+	prepTime, err := parseMinutes(form.Get("prep_time"))
+	if err != nil {
+		return nil, err
+	}
+	cookTime, err := parseMinutes(form.Get("cook_time"))
+	if err != nil {
+		return nil, err
+	}
+	steps, err := parseSteps(form)
+	if err != nil {
+		return nil, err
+	}
 
 	recipe.Name = name
-	recipe.Description = description
-	recipe.Instructions = instructions
+	recipe.Description = form.Get("description")
+	recipe.Servings = servings
+	recipe.PrepTime = prepTime
+	recipe.CookTime = cookTime
+	recipe.SourceURL = parseSourceURL(form.Get("source_url"))
+	if recipe.ParentID != nil && form.Has("variant") {
+		recipe.Variant = strings.TrimSpace(form.Get("variant"))
+		if recipe.Variant == "" {
+			return nil, errors.New("Give the variant a name, like \"vegan\"")
+		}
+	}
+	return steps, nil
+}
+
+// saveRecipeForm saves recipe, read by readRecipeForm, with the ingredients
+// and tags in form and steps in place of the ones it had. A variant only
+// saves what's different from its parent, but recipe is left as it reads.
+func saveRecipeForm(tx *gorm.DB, recipe *models.Recipe, form url.Values, steps []models.RecipeStep) error {
+	// Delete all recipe_ingredients for this recipe; the form always
+	// submits the full list.
+	if err := tx.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeIngredient{}).Error; err != nil {
+		return fmt.Errorf("failed to delete recipe_ingredients: %w", err)
+	}
+
+	ingredients, err := parseIngredients(tx, form["ingredients"], form["quantities"])
+	if err != nil {
+		return err
+	}
 	recipe.Ingredients = ingredients
 
-	if err := c.DB.Save(&recipe).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	// Likewise the steps.
+	if err := tx.Where("recipe_id = ?", recipe.ID).Delete(&models.RecipeStep{}).Error; err != nil {
+		return fmt.Errorf("failed to delete recipe_steps: %w", err)
 	}
+	linkStepIngredients(steps, ingredients)
+	recipe.Steps = steps
 
-	w.Header().Add("HX-Redirect", fmt.Sprintf("/recipes/%s", recipeID))
+	tags, err := parseTags(tx, form)
+	if err != nil {
+		return err
+	}
+	recipe.Tags = tags
+
+	parent, err := findParent(tx, *recipe)
+	if err != nil {
+		return err
+	}
+	if parent != nil {
+		*recipe = recipe.WithoutInherited(*parent)
+	}
+
+	if err := tx.Model(recipe).Association("Tags").Replace(recipe.Tags); err != nil {
+		return fmt.Errorf("failed to update tags: %w", err)
+	}
+	if err := tx.Save(recipe).Error; err != nil {
+		return err
+	}
+	if parent != nil {
+		*recipe = recipe.Inherit(*parent)
+	}
+	return nil
 }
 
-func (c *RecipeController) ParseIngredients(strIngredients []string, strQuantities []string) []models.Ingredient {
-	var ingredientList []models.Ingredient
+// parseIngredients turns the parallel name/quantity form fields into recipe
+// ingredient lines, parsing each quantity and resolving each name to a shared
+// Ingredient catalog row (creating it if needed).
+func parseIngredients(tx *gorm.DB, strIngredients []string, strQuantities []string) ([]models.RecipeIngredient, error) {
+	var ingredientList []models.RecipeIngredient
 
 	for i := 0; i < len(strIngredients); i++ {
-		ingredient := strings.TrimSpace(strIngredients[i])
-		quantity := strings.TrimSpace(strQuantities[i])
+		name := strings.TrimSpace(strIngredients[i])
+		var quantityText string
+		if i < len(strQuantities) {
+			quantityText = strings.TrimSpace(strQuantities[i])
+		}
 
-		if ingredient == "" {
+		if name == "" {
 			// ignore empty ingredients. no quantity is fine.
 			continue
 		}
 
-		ingredientList = append(ingredientList, models.Ingredient{Name: ingredient, Quantity: quantity})
+		var ingredient models.Ingredient
+		err := tx.Where(models.Ingredient{Name: catalog.Name(name)}).FirstOrCreate(&ingredient).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to find or create ingredient %q: %w", name, err)
+		}
+
+		amount := quantity.Parse(quantityText)
+		ingredientList = append(ingredientList, models.RecipeIngredient{
+			IngredientID: ingredient.ID,
+			Position:     len(ingredientList),
+			Name:         name,
+			QuantityText: amount.Text,
+			Quantity:     amount.Value,
+			QuantityMax:  amount.Max,
+			Unit:         amount.Unit,
+		})
+	}
+
+	return ingredientList, nil
+}
+
+// ingredientLine is an ingredient as shown on the recipe page, with its
+// quantity already scaled and formatted.
+type ingredientLine struct {
+	Name     string
+	Quantity string
+}
+
+// displayQuantity renders an ingredient's quantity scaled by scale and in the
+// viewer's preferred units. Untouched quantities are shown exactly as typed.
+func displayQuantity(ri models.RecipeIngredient, scale float64, viewer models.User) string {
+	amount := ri.Amount()
+	if scale == 1 && viewer.UnitSystem == "" && !viewer.WeighIngredients {
+		return amount.Text
+	}
+
+	amount = amount.Scale(scale)
+	system := viewer.UnitSystem
+	if system == "" {
+		if u, ok := units.Lookup(amount.Unit); ok && u.System != "" {
+			system = u.System
+		} else {
+			system = units.Metric
+		}
+	}
+	if viewer.WeighIngredients {
+		amount = amount.Weighed(ri.Ingredient.Name, system)
+	}
+	if viewer.UnitSystem != "" {
+		amount = amount.In(viewer.UnitSystem)
+	}
+	return amount.String()
+}
+
+func parseServings(s string) (int, error) {
+	if s == "" {
+		return 0, nil
 	}
+	servings, err := strconv.Atoi(s)
+	if err != nil || servings < 0 {
+		return 0, fmt.Errorf("servings must be a whole number")
+	}
+	return servings, nil
+}
+
+func parseMinutes(s string) (models.Minutes, error) {
+	if s == "" {
+		return 0, nil
+	}
+	minutes, err := strconv.Atoi(s)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("times must be a whole number of minutes")
+	}
+	return models.Minutes(minutes), nil
+}
+
+// parseSourceURL keeps the address a recipe came from if it's a web page,
+// since it's shown as a link.
+func parseSourceURL(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// preloadTags loads a recipe's tags grouped by kind.
+func preloadTags(db *gorm.DB) *gorm.DB {
+	return db.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("tags.kind ASC, tags.name ASC")
+	})
+}
 
-	return ingredientList
+// preloadIngredients loads a recipe's ingredient lines in the order they were
+// entered, along with their catalog rows.
+func preloadIngredients(db *gorm.DB) *gorm.DB {
+	return db.Preload("Ingredients", func(db *gorm.DB) *gorm.DB {
+		return db.Order("recipe_ingredients.position ASC")
+	}).Preload("Ingredients.Ingredient")
 }
@@ -0,0 +1,274 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/diff"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+// RevisionController shows a recipe's earlier versions and brings them back.
+type RevisionController struct {
+	DB     *gorm.DB
+	Engine *views.Engine
+}
+
+// RecipeHistory lists the saved versions of a recipe, newest first.
+func (c *RevisionController) RecipeHistory(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.LoggedInUserID(r)
+
+	var recipe models.Recipe
+	err := c.DB.Scopes(policy.ViewableRecipes(userID)).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if _, err := inheritParent(c.DB, &recipe); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var revisions []models.RecipeRevision
+	err = c.DB.Preload("Author").
+		Where("recipe_id = ?", recipe.ID).
+		Order("number DESC").
+		Find(&revisions).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var editable int64
+	err = c.DB.Model(&models.Recipe{}).
+		Scopes(policy.EditableRecipes(userID)).
+		Where("recipes.id = ?", recipe.ID).
+		Count(&editable).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.Render(w, "recipes-history.html", map[string]any{
+		"Recipe":         recipe,
+		"Revisions":      revisions,
+		"CanEdit":        editable > 0,
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// CompareRevisions shows a revision of a recipe side by side with the one
+// before it, or with ?against= another.
+func (c *RevisionController) CompareRevisions(w http.ResponseWriter, r *http.Request) {
+	var recipe models.Recipe
+	err := c.DB.Scopes(policy.ViewableRecipes(middleware.LoggedInUserID(r))).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if _, err := inheritParent(c.DB, &recipe); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	number, _ := strconv.Atoi(mux.Vars(r)["number"])
+	against := number - 1
+	if v := r.URL.Query().Get("against"); v != "" {
+		against, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "against must be a revision number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var revision models.RecipeRevision
+	err = c.DB.Preload("Author").
+		Where("recipe_id = ? AND number = ?", recipe.ID, number).
+		First(&revision).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	// The first revision is compared with nothing, so all of it is new.
+	var previous models.RecipeRevision
+	if against > 0 {
+		err = c.DB.Preload("Author").
+			Where("recipe_id = ? AND number = ?", recipe.ID, against).
+			First(&previous).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	}
+
+	err = c.Engine.Render(w, "recipes-revision.html", map[string]any{
+		"Recipe":   recipe,
+		"Revision": revision,
+		"Previous": previous,
+		"Sections": revisionDiff(previous, revision),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// RestoreRevision brings back an earlier version of a recipe by saving it
+// over the current one, as the recipe form would, so it becomes the newest
+// revision.
+func (c *RevisionController) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.LoggedInUserID(r)
+
+	var recipe models.Recipe
+	err := c.DB.Scopes(policy.EditableRecipes(userID)).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var revision models.RecipeRevision
+	err = c.DB.Where("recipe_id = ? AND number = ?", recipe.ID, mux.Vars(r)["number"]).
+		First(&revision).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	form := revisionForm(revision)
+	steps, err := readRecipeForm(&recipe, form)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Revision %d can't be restored: %s", revision.Number, err), http.StatusBadRequest)
+		return
+	}
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := saveRecipeForm(tx, &recipe, form, steps); err != nil {
+			return err
+		}
+		restored := models.NewRevision(recipe, userID)
+		restored.RestoredFrom = revision.Number
+		return recordRevision(tx, restored)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/recipes/%d", recipe.ID))
+}
+
+// recordRevision saves revision as the newest of its recipe's.
+func recordRevision(tx *gorm.DB, revision models.RecipeRevision) error {
+	err := tx.Model(&models.RecipeRevision{}).
+		Where("recipe_id = ?", revision.RecipeID).
+		Select("COALESCE(MAX(number), 0) + 1").
+		Scan(&revision.Number).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Create(&revision).Error; err != nil {
+		return fmt.Errorf("failed to save revision: %w", err)
+	}
+	return nil
+}
+
+// recordFirstRevision snapshots a recipe saved before revisions were kept,
+// as its owner last left it, so that editing it doesn't lose that version.
+// It does nothing for recipes that have revisions.
+func recordFirstRevision(tx *gorm.DB, recipeID uint) error {
+	var count int64
+	if err := tx.Model(&models.RecipeRevision{}).Where("recipe_id = ?", recipeID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var recipe models.Recipe
+	if err := tx.Scopes(preloadIngredients, preloadSteps, preloadTags).First(&recipe, recipeID).Error; err != nil {
+		return err
+	}
+	revision := models.NewRevision(recipe, recipe.UserID)
+	revision.CreatedAt = recipe.UpdatedAt
+	return recordRevision(tx, revision)
+}
+
+// revisionForm is revision as the recipe form would submit it.
+func revisionForm(revision models.RecipeRevision) url.Values {
+	form := url.Values{
+		"name":        {revision.Name},
+		"description": {revision.Description},
+		"source_url":  {revision.SourceURL},
+	}
+	if revision.Servings > 0 {
+		form.Set("servings", strconv.Itoa(revision.Servings))
+	}
+	if revision.PrepTime > 0 {
+		form.Set("prep_time", strconv.Itoa(int(revision.PrepTime)))
+	}
+	if revision.CookTime > 0 {
+		form.Set("cook_time", strconv.Itoa(int(revision.CookTime)))
+	}
+	for _, ingredient := range revision.Ingredients {
+		form.Add("ingredients", ingredient.Name)
+		form.Add("quantities", ingredient.Quantity)
+	}
+	for _, step := range revision.Steps {
+		form.Add("steps", step.Text)
+		form.Add("step_durations", strconv.Itoa(int(step.Duration)))
+		form.Add("step_ingredients", strings.Join(step.Ingredients, "\n"))
+	}
+	tags := map[models.TagKind][]string{}
+	for _, tag := range revision.Tags {
+		tags[tag.Kind] = append(tags[tag.Kind], tag.Name)
+	}
+	for kind, names := range tags {
+		form.Set("tags_"+string(kind), strings.Join(names, ", "))
+	}
+	return form
+}
+
+// diffSection is one part of a recipe compared between two versions.
+type diffSection struct {
+	Title string
+	Rows  []diff.Row
+}
+
+func (s diffSection) Changed() bool {
+	return diff.Differs(s.Rows)
+}
+
+// revisionDiff compares the parts of two versions of a recipe that people
+// change most: its name, ingredients and instructions.
+func revisionDiff(before, after models.RecipeRevision) []diffSection {
+	var beforeName, afterName []string
+	if before.Name != "" {
+		beforeName = []string{before.Name}
+	}
+	if after.Name != "" {
+		afterName = []string{after.Name}
+	}
+	return []diffSection{
+		{"Name", diff.SideBySide(beforeName, afterName)},
+		{"Ingredients", diff.SideBySide(before.IngredientLines(), after.IngredientLines())},
+		{"Instructions", diff.SideBySide(before.StepLines(), after.StepLines())},
+	}
+}
@@ -0,0 +1,287 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/csrf"
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
+	"github.com/imsteev/recipebook/shopping"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+type ShoppingListController struct {
+	DB     *gorm.DB
+	Engine *views.Engine
+}
+
+func (c *ShoppingListController) ListShoppingLists(w http.ResponseWriter, r *http.Request) {
+	var lists []models.ShoppingList
+	err := c.DB.Where("user_id = ?", middleware.LoggedInUserID(r)).
+		Order("created_at DESC").
+		Find(&lists).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.Render(w, "shoppinglists-list.html", map[string]any{
+		"ShoppingLists": lists,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *ShoppingListController) NewShoppingList(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.LoggedInUserID(r)
+
+	var recipes []models.Recipe
+	if err := c.DB.Scopes(policy.ViewableRecipes(userID)).Find(&recipes).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := inheritParents(c.DB, eachRecipe(recipes)...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	sortRecipes(recipes)
+	var recipebooks []models.RecipeBook
+	if err := c.DB.Scopes(policy.ViewableRecipeBooks(userID)).Order("name ASC").Find(&recipebooks).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err := c.Engine.Render(w, "shoppinglists-new.html", map[string]any{
+		"Recipes":        recipes,
+		"RecipeBooks":    recipebooks,
+		csrf.TemplateTag: csrf.TemplateField(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *ShoppingListController) CreateShoppingList(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userID := middleware.LoggedInUserID(r)
+
+	var recipeIDs []uint
+	for _, v := range r.PostForm["recipe_ids"] {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid recipe ID", http.StatusBadRequest)
+			return
+		}
+		recipeIDs = append(recipeIDs, uint(id))
+	}
+
+	var recipes []models.Recipe
+	if len(recipeIDs) > 0 {
+		err := c.DB.Scopes(policy.ViewableRecipes(userID), preloadIngredients).
+			Where("recipes.id IN ?", recipeIDs).
+			Find(&recipes).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if recipeBookID := r.PostFormValue("recipebook_id"); recipeBookID != "" {
+		var recipebook models.RecipeBook
+		err := c.DB.Scopes(policy.ViewableRecipeBooks(userID)).
+			Where("recipe_books.id = ?", recipeBookID).
+			First(&recipebook).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		var bookRecipes []models.Recipe
+		err = c.DB.Scopes(preloadIngredients).
+			Where("id IN (?)", c.DB.Model(&models.RecipeBookRecipe{}).Select("recipe_id").Where("recipe_book_id = ?", recipebook.ID)).
+			Find(&bookRecipes).Error
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		recipes = append(recipes, bookRecipes...)
+	}
+	if err := inheritParents(c.DB, eachRecipe(recipes)...); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(recipes) == 0 {
+		http.Error(w, "Pick at least one recipe or recipe book", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	if name == "" {
+		name = fmt.Sprintf("Shopping list for %d recipes", len(recipes))
+	}
+
+	list, err := createShoppingList(c.DB, userID, name, recipes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/shoppinglists/%d", list.ID))
+}
+
+func (c *ShoppingListController) GetShoppingList(w http.ResponseWriter, r *http.Request) {
+	list, err := c.findShoppingList(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	err = c.Engine.Render(w, "shoppinglists-show.html", map[string]any{
+		"ShoppingList": list,
+		"Groups":       groupByCategory(list.Items),
+		"csrfToken":    csrf.Token(r),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+func (c *ShoppingListController) ToggleShoppingListItem(w http.ResponseWriter, r *http.Request) {
+	list, err := c.findShoppingList(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var item models.ShoppingListItem
+	err = c.DB.Where("id = ? AND shopping_list_id = ?", mux.Vars(r)["itemID"], list.ID).First(&item).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	item.Checked = !item.Checked
+	if err := c.DB.Model(&item).Update("checked", item.Checked).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = c.Engine.RenderPartial(w, "shoppinglists-show.html", "shopping-item", item)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// ExportShoppingList downloads the list as plain text, grouped by aisle.
+func (c *ShoppingListController) ExportShoppingList(w http.ResponseWriter, r *http.Request) {
+	list, err := c.findShoppingList(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(list.Name + "\n")
+	for _, group := range groupByCategory(list.Items) {
+		fmt.Fprintf(&b, "\n%s\n", group.Category)
+		for _, item := range group.Items {
+			check := " "
+			if item.Checked {
+				check = "x"
+			}
+			fmt.Fprintf(&b, "[%s] %s", check, item.Name)
+			if item.Quantity != "" {
+				fmt.Fprintf(&b, " (%s)", item.Quantity)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="shopping-list-%d.txt"`, list.ID))
+	w.Write([]byte(b.String()))
+}
+
+func (c *ShoppingListController) DeleteShoppingList(w http.ResponseWriter, r *http.Request) {
+	list, err := c.findShoppingList(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("shopping_list_id = ?", list.ID).Delete(&models.ShoppingListItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&list).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", "/shoppinglists")
+}
+
+// findShoppingList loads the list named by the {id} route variable, along
+// with its items, if it belongs to the logged in user.
+func (c *ShoppingListController) findShoppingList(r *http.Request) (models.ShoppingList, error) {
+	var list models.ShoppingList
+	err := c.DB.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("shopping_list_items.position ASC")
+	}).
+		Where("id = ? AND user_id = ?", mux.Vars(r)["id"], middleware.LoggedInUserID(r)).
+		First(&list).Error
+	return list, err
+}
+
+// createShoppingList consolidates the ingredients of recipes into a new
+// saved list. Recipes must have their ingredients preloaded.
+func createShoppingList(db *gorm.DB, userID uint, name string, recipes []models.Recipe) (models.ShoppingList, error) {
+	list := models.ShoppingList{UserID: userID, Name: name}
+	for i, item := range shopping.FromRecipes(recipes) {
+		list.Items = append(list.Items, models.ShoppingListItem{
+			Position: i,
+			Category: item.Category,
+			Name:     item.Name,
+			Quantity: item.Quantity(),
+		})
+	}
+	if err := db.Create(&list).Error; err != nil {
+		return list, err
+	}
+	return list, nil
+}
+
+type shoppingListGroup struct {
+	Category string
+	Items    []models.ShoppingListItem
+}
+
+// groupByCategory splits items into aisles, keeping their saved order.
+func groupByCategory(items []models.ShoppingListItem) []shoppingListGroup {
+	var groups []shoppingListGroup
+	for _, item := range items {
+		if len(groups) == 0 || groups[len(groups)-1].Category != item.Category {
+			groups = append(groups, shoppingListGroup{Category: item.Category})
+		}
+		groups[len(groups)-1].Items = append(groups[len(groups)-1].Items, item)
+	}
+	return groups
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/models"
+	"gorm.io/gorm"
+)
+
+// parseSteps reads the steps typed into the recipe form, which has parallel
+// "steps", "step_durations" and "step_ingredients" fields, a set per step in
+// order. Each step's ingredients are one per line, since a line break can't
+// be part of an ingredient's name, and must be among the form's
+// "ingredients". They're returned by catalog name only; linkStepIngredients
+// fills in their rows once the ingredients are saved.
+func parseSteps(form url.Values) ([]models.RecipeStep, error) {
+	inRecipe := map[string]bool{}
+	asTyped := map[string]bool{}
+	for _, name := range form["ingredients"] {
+		inRecipe[catalog.Name(name)] = true
+		asTyped[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	texts, durations, uses := form["steps"], form["step_durations"], form["step_ingredients"]
+	var steps []models.RecipeStep
+	for i, text := range texts {
+		text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+		if text == "" {
+			continue
+		}
+		step := models.RecipeStep{Position: len(steps), Text: text}
+
+		if i < len(durations) {
+			duration, err := parseMinutes(strings.TrimSpace(durations[i]))
+			if err != nil {
+				return nil, fmt.Errorf("step %d: %w", step.Position+1, err)
+			}
+			step.Duration = duration
+		}
+
+		if i < len(uses) {
+			seen := map[string]bool{}
+			for _, name := range stepIngredientNames(uses[i], asTyped) {
+				normalized := catalog.Name(name)
+				if !inRecipe[normalized] {
+					return nil, fmt.Errorf("step %d uses %q, which isn't one of the ingredients", step.Position+1, name)
+				}
+				if !seen[normalized] {
+					seen[normalized] = true
+					step.Ingredients = append(step.Ingredients, models.Ingredient{Name: normalized})
+				}
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// stepIngredientNames splits what was typed into a step's "Uses" box into
+// ingredient names, one per line. A line that isn't an ingredient as typed
+// (asTyped is keyed lowercased) may list several separated by commas, as
+// the box used to take them.
+func stepIngredientNames(uses string, asTyped map[string]bool) []string {
+	var names []string
+	for _, line := range strings.Split(uses, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if asTyped[strings.ToLower(line)] {
+			names = append(names, line)
+			continue
+		}
+		for _, name := range strings.Split(line, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// linkStepIngredients points each step's ingredients, which parseSteps
+// left as names, at the catalog rows of the matching ingredient lines.
+func linkStepIngredients(steps []models.RecipeStep, ingredients []models.RecipeIngredient) {
+	ids := map[string]uint{}
+	for _, ri := range ingredients {
+		ids[catalog.Name(ri.Name)] = ri.IngredientID
+	}
+	for i := range steps {
+		for j := range steps[i].Ingredients {
+			steps[i].Ingredients[j].ID = ids[steps[i].Ingredients[j].Name]
+		}
+	}
+}
+
+// preloadSteps loads a recipe's steps in order, with the ingredients each
+// one uses.
+func preloadSteps(db *gorm.DB) *gorm.DB {
+	return db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("recipe_steps.position ASC")
+	}).Preload("Steps.Ingredients")
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/imsteev/recipebook/models"
+	"gorm.io/gorm"
+)
+
+// parseTags finds or creates the tags typed into the recipe form, which has
+// one comma-separated field per kind ("tags_cuisine", "tags_course", ...).
+func parseTags(tx *gorm.DB, form url.Values) ([]models.Tag, error) {
+	var named []models.Tag
+	for _, kind := range models.TagKinds {
+		for _, name := range strings.Split(form.Get("tags_"+string(kind)), ",") {
+			named = append(named, models.Tag{Kind: kind, Name: name})
+		}
+	}
+	return findOrCreateTags(tx, named)
+}
+
+// findOrCreateTags looks up tags by kind and name, creating any that don't
+// exist yet. Names are normalized first, and empty names and repeats are
+// dropped.
+func findOrCreateTags(tx *gorm.DB, named []models.Tag) ([]models.Tag, error) {
+	var tags []models.Tag
+	seen := map[models.Tag]bool{}
+	for _, t := range named {
+		key := models.Tag{Kind: t.Kind, Name: models.NormalizeTagName(t.Name)}
+		if key.Name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		var tag models.Tag
+		if err := tx.Where(key).FirstOrCreate(&tag).Error; err != nil {
+			return nil, fmt.Errorf("failed to find or create tag %q: %w", key.Name, err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, nil
+}
+
+// tagFields is the inverse of parseTags: the recipe's tags as the form
+// shows them, keyed by kind.
+func tagFields(tags []models.Tag) map[models.TagKind]string {
+	fields := map[models.TagKind]string{}
+	for _, tag := range tags {
+		if fields[tag.Kind] != "" {
+			fields[tag.Kind] += ", "
+		}
+		fields[tag.Kind] += tag.Name
+	}
+	return fields
+}
+
+// taggedWith limits a query on recipes to those with every one of the named
+// tags.
+func taggedWith(names []string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if len(names) == 0 {
+			return db
+		}
+		// A variant that doesn't override its tags has its parent's.
+		return db.Where(`(CASE
+			WHEN recipes.parent_id IS NULL OR recipes.overrides LIKE '%"tags"%' THEN recipes.id
+			ELSE recipes.parent_id END) IN (
+			SELECT recipe_tags.recipe_id FROM recipe_tags
+			JOIN tags ON tags.id = recipe_tags.tag_id
+			WHERE tags.name IN ?
+			GROUP BY recipe_tags.recipe_id
+			HAVING COUNT(DISTINCT tags.name) = ?
+		)`, names, len(names))
+	}
+}
+
+// tagFilter is a tag that can be switched on or off in a list of recipes.
+type tagFilter struct {
+	models.Tag
+	Active bool
+	URL    string // the current page with this tag toggled
+}
+
+// tagFilters builds the filter links for tags on the current page, keeping
+// its other query parameters. active is the ?tag= values in effect.
+func tagFilters(r *http.Request, tags []models.Tag, active []string) []tagFilter {
+	isActive := map[string]bool{}
+	for _, name := range active {
+		isActive[name] = true
+	}
+
+	filters := make([]tagFilter, len(tags))
+	for i, tag := range tags {
+		query := r.URL.Query()
+		query.Del("tag")
+		for _, name := range active {
+			if name != tag.Name {
+				query.Add("tag", name)
+			}
+		}
+		if !isActive[tag.Name] {
+			query.Add("tag", tag.Name)
+		}
+		u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+		filters[i] = tagFilter{Tag: tag, Active: isActive[tag.Name], URL: u.String()}
+	}
+	return filters
+}
+
+// activeTags returns the normalized ?tag= values of the request.
+func activeTags(r *http.Request) []string {
+	var names []string
+	for _, name := range r.URL.Query()["tag"] {
+		if name = models.NormalizeTagName(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// hasTags reports whether tags includes every one of names.
+func hasTags(tags []models.Tag, names []string) bool {
+	for _, name := range names {
+		found := false
+		for _, tag := range tags {
+			if tag.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueTags returns the distinct tags among recipes, sorted by kind then
+// name.
+func uniqueTags(recipes []models.Recipe) []models.Tag {
+	var tags []models.Tag
+	seen := map[uint]bool{}
+	for _, recipe := range recipes {
+		for _, tag := range recipe.Tags {
+			if !seen[tag.ID] {
+				seen[tag.ID] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sortTags(tags)
+	return tags
+}
+
+func sortTags(tags []models.Tag) {
+	rank := map[models.TagKind]int{}
+	for i, kind := range models.TagKinds {
+		rank[kind] = i
+	}
+	sort.SliceStable(tags, func(i, j int) bool {
+		if rank[tags[i].Kind] != rank[tags[j].Kind] {
+			return rank[tags[i].Kind] < rank[tags[j].Kind]
+		}
+		return tags[i].Name < tags[j].Name
+	})
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/units"
+	"github.com/imsteev/recipebook/views"
+	"gorm.io/gorm"
+)
+
+type UserController struct {
+	DB     *gorm.DB
+	Engine *views.Engine
+}
+
+func (c *UserController) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	system := units.System(r.PostFormValue("unit_system"))
+	if system != "" && system != units.Metric && system != units.US {
+		http.Error(w, "Unknown unit system", http.StatusBadRequest)
+		return
+	}
+
+	err = c.DB.Model(&models.User{}).
+		Where("id = ?", middleware.LoggedInUserID(r)).
+		Updates(map[string]any{
+			"unit_system":       system,
+			"weigh_ingredients": r.PostFormValue("weigh_ingredients") != "",
+		}).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Refresh", "true")
+}
@@ -0,0 +1,191 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/imsteev/recipebook/middleware"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/policy"
+	"gorm.io/gorm"
+)
+
+// CreateVariant starts a variant of a recipe, named by the form's
+// "variant". It begins as an exact copy, since it inherits everything, and
+// the user is sent to edit it. A variant of a variant is a variant of the
+// original.
+func (c *RecipeController) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.LoggedInUserID(r)
+
+	var recipe models.Recipe
+	err := c.DB.Scopes(policy.EditableRecipes(userID)).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("variant"))
+	if name == "" {
+		http.Error(w, "Give the variant a name, like \"vegan\"", http.StatusBadRequest)
+		return
+	}
+
+	parentID := recipe.ID
+	if recipe.ParentID != nil {
+		parentID = *recipe.ParentID
+	}
+	var parent models.Recipe
+	err = c.DB.Scopes(preloadIngredients, preloadSteps, preloadTags).First(&parent, parentID).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	variant := models.Recipe{UserID: userID, ParentID: &parent.ID, Variant: name, Overrides: []string{}}
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&variant).Error; err != nil {
+			return err
+		}
+		return recordRevision(tx, models.NewRevision(variant.Inherit(parent), userID))
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("HX-Redirect", fmt.Sprintf("/recipes/%d/edit", variant.ID))
+}
+
+// CompareVariant shows a variant side by side with the recipe it's a
+// variant of.
+func (c *RecipeController) CompareVariant(w http.ResponseWriter, r *http.Request) {
+	var recipe models.Recipe
+	err := c.DB.Scopes(policy.ViewableRecipes(middleware.LoggedInUserID(r)), preloadIngredients, preloadSteps, preloadTags).
+		Where("recipes.id = ?", mux.Vars(r)["id"]).
+		First(&recipe).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	parent, err := inheritParent(c.DB, &recipe)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if parent == nil {
+		http.Error(w, "This recipe isn't a variant", http.StatusNotFound)
+		return
+	}
+
+	err = c.Engine.Render(w, "recipes-variant-diff.html", map[string]any{
+		"Recipe":   recipe,
+		"Parent":   parent,
+		"Sections": revisionDiff(models.NewRevision(*parent, 0), models.NewRevision(recipe, 0)),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// findParent loads the recipe a variant is a variant of, with everything
+// Inherit needs. It's nil if recipe isn't a variant.
+func findParent(db *gorm.DB, recipe models.Recipe) (*models.Recipe, error) {
+	if recipe.ParentID == nil {
+		return nil, nil
+	}
+	var parent models.Recipe
+	err := db.Scopes(preloadIngredients, preloadSteps, preloadTags, preloadPhotos).
+		First(&parent, *recipe.ParentID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &parent, nil
+}
+
+// inheritParent fills in what a variant leaves to its parent, which it
+// returns. recipe must have its ingredients, steps, tags and photos loaded,
+// or the parent's are taken for its own.
+func inheritParent(db *gorm.DB, recipe *models.Recipe) (*models.Recipe, error) {
+	parent, err := findParent(db, *recipe)
+	if parent != nil {
+		*recipe = recipe.Inherit(*parent)
+	}
+	return parent, err
+}
+
+// inheritParents is inheritParent for many recipes at once, loading all
+// their parents in one query. Each recipe must have whatever it's used for
+// loaded, like inheritParent's.
+func inheritParents(db *gorm.DB, recipes ...*models.Recipe) error {
+	var parentIDs []uint
+	for _, recipe := range recipes {
+		if recipe.ParentID != nil {
+			parentIDs = append(parentIDs, *recipe.ParentID)
+		}
+	}
+	if len(parentIDs) == 0 {
+		return nil
+	}
+	var parents []models.Recipe
+	err := db.Scopes(preloadIngredients, preloadSteps, preloadTags, preloadPhotos).
+		Where("recipes.id IN ?", parentIDs).
+		Find(&parents).Error
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Recipe, len(parents))
+	for _, parent := range parents {
+		byID[parent.ID] = parent
+	}
+	for _, recipe := range recipes {
+		if recipe.ParentID != nil {
+			*recipe = recipe.Inherit(byID[*recipe.ParentID])
+		}
+	}
+	return nil
+}
+
+// sortRecipes puts recipes in order of their full names, so a variant
+// comes right after its original. They must have inherited their names.
+func sortRecipes(recipes []models.Recipe) {
+	sort.SliceStable(recipes, func(i, j int) bool {
+		return strings.ToLower(recipes[i].FullName()) < strings.ToLower(recipes[j].FullName())
+	})
+}
+
+// eachRecipe points at each of recipes, for inheritParents.
+func eachRecipe(recipes []models.Recipe) []*models.Recipe {
+	pointers := make([]*models.Recipe, len(recipes))
+	for i := range recipes {
+		pointers[i] = &recipes[i]
+	}
+	return pointers
+}
+
+// variantFamily is a recipe and its variants, shown as tabs on each of
+// their pages.
+type variantFamily struct {
+	Original models.Recipe
+	Variants []models.Recipe
+}
+
+// findVariantFamily loads the family recipe belongs to: itself and its
+// variants if it's an original, otherwise its parent's. Only the variants
+// userID can see are included.
+func findVariantFamily(db *gorm.DB, recipe models.Recipe, parent *models.Recipe, userID uint) (variantFamily, error) {
+	family := variantFamily{Original: recipe}
+	if parent != nil {
+		family.Original = *parent
+	}
+	err := db.Scopes(policy.ViewableRecipes(userID)).
+		Where("recipes.parent_id = ?", family.Original.ID).
+		Order("recipes.created_at ASC").
+		Find(&family.Variants).Error
+	return family, err
+}
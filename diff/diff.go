@@ -0,0 +1,99 @@
+// Package diff compares two versions of a list of lines, such as a recipe's
+// ingredients before and after an edit, for showing side by side.
+package diff
+
+// Kind is what happened to a line between the two versions.
+type Kind int
+
+const (
+	Same    Kind = iota
+	Removed      // only in the old version
+	Added        // only in the new version
+	Changed      // the old line was replaced by the new one
+)
+
+// Row is one line of a side-by-side diff, with the old version's line on
+// the left and the new version's on the right. A removed line leaves New
+// empty, and an added one Old.
+type Row struct {
+	Kind Kind
+	Old  string
+	New  string
+}
+
+// OldChanged reports whether the left side should be marked as changed.
+func (r Row) OldChanged() bool {
+	return r.Kind == Removed || r.Kind == Changed
+}
+
+// NewChanged reports whether the right side should be marked as changed.
+func (r Row) NewChanged() bool {
+	return r.Kind == Added || r.Kind == Changed
+}
+
+// SideBySide lines up the lines before and after a change, keeping their
+// longest common run of lines in place. Where lines were removed and others
+// added in the same place, they're paired up as changed, so an edited line
+// sits beside its new text.
+func SideBySide(before, after []string) []Row {
+	// common[i][j] is the length of the longest common subsequence of
+	// before[i:] and after[j:].
+	common := make([][]int, len(before)+1)
+	for i := range common {
+		common[i] = make([]int, len(after)+1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		for j := len(after) - 1; j >= 0; j-- {
+			if before[i] == after[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	var rows []Row
+	var removed, added []string
+	flush := func() {
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			switch {
+			case k >= len(added):
+				rows = append(rows, Row{Kind: Removed, Old: removed[k]})
+			case k >= len(removed):
+				rows = append(rows, Row{Kind: Added, New: added[k]})
+			default:
+				rows = append(rows, Row{Kind: Changed, Old: removed[k], New: added[k]})
+			}
+		}
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case i < len(before) && j < len(after) && before[i] == after[j]:
+			flush()
+			rows = append(rows, Row{Kind: Same, Old: before[i], New: after[j]})
+			i++
+			j++
+		case j == len(after) || (i < len(before) && common[i+1][j] >= common[i][j+1]):
+			removed = append(removed, before[i])
+			i++
+		default:
+			added = append(added, after[j])
+			j++
+		}
+	}
+	flush()
+	return rows
+}
+
+// Differs reports whether any of rows aren't the same on both sides.
+func Differs(rows []Row) bool {
+	for _, row := range rows {
+		if row.Kind != Same {
+			return true
+		}
+	}
+	return false
+}
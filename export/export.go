@@ -0,0 +1,87 @@
+// Package export writes recipes and recipe books out in formats other tools
+// read: the models' own JSON, schema.org JSON-LD, Markdown, and a zip that
+// bundles all three with the recipes' photos. It also lays them out as PDFs
+// to print.
+//
+// Recipes must have their Ingredients, Steps, Tags and Photos loaded, in
+// order.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/imsteev/recipebook/models"
+)
+
+// Book is a recipe book as exported: its name and its recipes in order.
+type Book struct {
+	Name    string          `json:"name"`
+	Recipes []models.Recipe `json:"recipes"`
+}
+
+// NewBook collects a recipe book's recipes for export. The book must have
+// Recipes.Recipe loaded.
+func NewBook(recipebook models.RecipeBook) Book {
+	book := Book{Name: recipebook.Name}
+	for _, entry := range recipebook.Recipes {
+		book.Recipes = append(book.Recipes, entry.Recipe)
+	}
+	return book
+}
+
+// JSON writes v, a models.Recipe or a Book, as indented JSON using the
+// models' json tags.
+func JSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// FileName turns name into something safe to use as a file name: "Mom's
+// Apple Pie" becomes "moms-apple-pie".
+func FileName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r == '\'' || r == '’':
+			continue
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "recipe"
+	}
+	return b.String()
+}
+
+// ingredientLine is an ingredient as a recipe card writes it: "2 cups flour".
+func ingredientLine(ri models.RecipeIngredient) string {
+	if ri.QuantityText == "" {
+		return ri.DisplayName()
+	}
+	return ri.QuantityText + " " + ri.DisplayName()
+}
+
+// photoName is the name a recipe's photo is stored under in a zip.
+func photoName(photo models.RecipePhoto, i int) string {
+	ext := ".jpg"
+	switch photo.ContentType {
+	case "image/png":
+		ext = ".png"
+	case "image/gif":
+		ext = ".gif"
+	}
+	return fmt.Sprintf("photos/%d%s", i+1, ext)
+}
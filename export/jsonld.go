@@ -0,0 +1,113 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/imsteev/recipebook/models"
+)
+
+// RecipeJSONLD describes recipe as a schema.org Recipe. images are the
+// addresses of its photos, where the reader will find them; pass nil to
+// leave them out.
+func RecipeJSONLD(recipe models.Recipe, images []string) map[string]any {
+	doc := map[string]any{
+		"@context":     "https://schema.org",
+		"@type":        "Recipe",
+		"name":         recipe.Name,
+		"dateCreated":  recipe.CreatedAt.Format("2006-01-02"),
+		"dateModified": recipe.UpdatedAt.Format("2006-01-02"),
+	}
+	if recipe.Description != "" {
+		doc["description"] = recipe.Description
+	}
+	if recipe.Servings > 0 {
+		doc["recipeYield"] = strconv.Itoa(recipe.Servings)
+	}
+	if recipe.PrepTime > 0 {
+		doc["prepTime"] = isoDuration(recipe.PrepTime)
+	}
+	if recipe.CookTime > 0 {
+		doc["cookTime"] = isoDuration(recipe.CookTime)
+	}
+	if recipe.PrepTime > 0 && recipe.CookTime > 0 {
+		doc["totalTime"] = isoDuration(recipe.TotalTime())
+	}
+	if recipe.SourceURL != "" {
+		doc["isBasedOn"] = recipe.SourceURL
+	}
+	if len(images) > 0 {
+		doc["image"] = images
+	}
+
+	ingredients := []string{}
+	for _, ri := range recipe.Ingredients {
+		ingredients = append(ingredients, ingredientLine(ri))
+	}
+	doc["recipeIngredient"] = ingredients
+
+	instructions := []map[string]any{}
+	for _, step := range recipe.Steps {
+		howTo := map[string]any{"@type": "HowToStep", "text": step.Text}
+		if step.Duration > 0 {
+			howTo["timeRequired"] = isoDuration(step.Duration)
+		}
+		instructions = append(instructions, howTo)
+	}
+	doc["recipeInstructions"] = instructions
+
+	var cuisines, categories, keywords []string
+	for _, tag := range recipe.Tags {
+		switch tag.Kind {
+		case models.TagCuisine:
+			cuisines = append(cuisines, tag.Name)
+		case models.TagCourse:
+			categories = append(categories, tag.Name)
+		default:
+			keywords = append(keywords, tag.Name)
+		}
+	}
+	if len(cuisines) > 0 {
+		doc["recipeCuisine"] = cuisines
+	}
+	if len(categories) > 0 {
+		doc["recipeCategory"] = categories
+	}
+	if len(keywords) > 0 {
+		doc["keywords"] = keywords
+	}
+	return doc
+}
+
+// BookJSONLD describes book as a schema.org ItemList of its recipes, in
+// order.
+func BookJSONLD(book Book) map[string]any {
+	items := []map[string]any{}
+	for i, recipe := range book.Recipes {
+		item := RecipeJSONLD(recipe, nil)
+		delete(item, "@context")
+		items = append(items, map[string]any{
+			"@type":    "ListItem",
+			"position": i + 1,
+			"item":     item,
+		})
+	}
+	return map[string]any{
+		"@context":        "https://schema.org",
+		"@type":           "ItemList",
+		"name":            book.Name,
+		"itemListElement": items,
+	}
+}
+
+// isoDuration writes m as an ISO 8601 duration, "PT1H30M".
+func isoDuration(m models.Minutes) string {
+	hours, minutes := int(m)/60, int(m)%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("PT%dM", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("PT%dH", hours)
+	}
+	return fmt.Sprintf("PT%dH%dM", hours, minutes)
+}
@@ -0,0 +1,82 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/imsteev/recipebook/models"
+)
+
+// RecipeMarkdown writes recipe as a Markdown document. images are the paths
+// of its photos to link, or nil to leave them out.
+func RecipeMarkdown(w io.Writer, recipe models.Recipe, images []string) error {
+	bw := bufio.NewWriter(w)
+	writeRecipe(bw, recipe, images, 1)
+	return bw.Flush()
+}
+
+// BookMarkdown writes every recipe in book into one Markdown document, under
+// the book's name.
+func BookMarkdown(w io.Writer, book Book) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# %s\n", book.Name)
+	for _, recipe := range book.Recipes {
+		bw.WriteString("\n")
+		writeRecipe(bw, recipe, nil, 2)
+	}
+	return bw.Flush()
+}
+
+// writeRecipe writes recipe with its title at the given heading level.
+func writeRecipe(w *bufio.Writer, recipe models.Recipe, images []string, level int) {
+	heading := strings.Repeat("#", level)
+	fmt.Fprintf(w, "%s %s\n", heading, recipe.Name)
+
+	if recipe.Description != "" {
+		fmt.Fprintf(w, "\n%s\n", recipe.Description)
+	}
+	for _, image := range images {
+		fmt.Fprintf(w, "\n![%s](%s)\n", recipe.Name, image)
+	}
+
+	var details []string
+	if recipe.Servings > 0 {
+		details = append(details, fmt.Sprintf("Serves %d", recipe.Servings))
+	}
+	if recipe.PrepTime > 0 {
+		details = append(details, "Prep "+recipe.PrepTime.String())
+	}
+	if recipe.CookTime > 0 {
+		details = append(details, "Cook "+recipe.CookTime.String())
+	}
+	if len(details) > 0 {
+		fmt.Fprintf(w, "\n%s\n", strings.Join(details, " · "))
+	}
+	if len(recipe.Tags) > 0 {
+		names := make([]string, len(recipe.Tags))
+		for i, tag := range recipe.Tags {
+			names[i] = tag.Name
+		}
+		fmt.Fprintf(w, "\nTags: %s\n", strings.Join(names, ", "))
+	}
+
+	if len(recipe.Ingredients) > 0 {
+		fmt.Fprintf(w, "\n%s# Ingredients\n\n", heading)
+		for _, ri := range recipe.Ingredients {
+			fmt.Fprintf(w, "- %s\n", ingredientLine(ri))
+		}
+	}
+	if len(recipe.Steps) > 0 {
+		fmt.Fprintf(w, "\n%s# Instructions\n\n", heading)
+		for i, step := range recipe.Steps {
+			// a step's later lines are indented to stay within its list item
+			fmt.Fprintf(w, "%d. %s\n", i+1, strings.ReplaceAll(step.Text, "\n", "\n   "))
+		}
+	}
+
+	if recipe.SourceURL != "" {
+		fmt.Fprintf(w, "\nFrom <%s>\n", recipe.SourceURL)
+	}
+}
@@ -0,0 +1,272 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/pdf"
+	"github.com/imsteev/recipebook/storage"
+)
+
+// Page layout for PDFs, in points.
+const (
+	margin      = 72
+	textWidth   = pdf.LetterWidth - 2*margin
+	photoHeight = 180
+)
+
+// RecipePDF writes recipe as a one-recipe PDF, on as many pages as it needs.
+// Its cover photo's thumbnail is read from photos.
+func RecipePDF(w io.Writer, recipe models.Recipe, photos storage.Store) error {
+	doc := pdf.New(pdf.LetterWidth, pdf.LetterHeight)
+	doc.Title = recipe.Name
+	if _, err := writeRecipePages(doc, recipe, photos); err != nil {
+		return err
+	}
+	numberPages(doc, 1)
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// BookPDF writes book as a PDF to print: a title page, a table of contents,
+// then each recipe starting on a page of its own.
+func BookPDF(w io.Writer, book Book, photos storage.Store) error {
+	doc := pdf.New(pdf.LetterWidth, pdf.LetterHeight)
+	doc.Title = book.Name
+
+	title := doc.AddPage()
+	y := pdf.LetterHeight / 3.0
+	for _, line := range pdf.Wrap(pdf.Bold, 32, book.Name, textWidth) {
+		centered(title, y, pdf.Bold, 32, line)
+		y += 40
+	}
+	title.SetGray(0.4)
+	count := fmt.Sprintf("%d recipes", len(book.Recipes))
+	if len(book.Recipes) == 1 {
+		count = "1 recipe"
+	}
+	centered(title, y+8, pdf.Italic, 14, count)
+
+	// The contents come before the recipes but list their page numbers, so
+	// their pages are saved now and filled in once the recipes are laid out.
+	const entryHeight = 20
+	perPage := int((pdf.LetterHeight - 2*margin - 48) / entryHeight)
+	contents := make([]*pdf.Page, max(1, int(math.Ceil(float64(len(book.Recipes))/float64(perPage)))))
+	for i := range contents {
+		contents[i] = doc.AddPage()
+	}
+
+	starts := make([]*pdf.Page, len(book.Recipes))
+	numbers := make([]int, len(book.Recipes))
+	for i, recipe := range book.Recipes {
+		numbers[i] = len(doc.Pages()) + 1
+		start, err := writeRecipePages(doc, recipe, photos)
+		if err != nil {
+			return err
+		}
+		starts[i] = start
+	}
+
+	for i, page := range contents {
+		y := float64(margin)
+		if i == 0 {
+			page.Text(margin, y+20, pdf.Bold, 24, "Contents")
+		}
+		y += 48
+		for j := i * perPage; j < min(len(book.Recipes), (i+1)*perPage); j++ {
+			number := fmt.Sprint(numbers[j])
+			numberWidth := pdf.Width(pdf.Regular, 12, number)
+			name := fit(pdf.Regular, 12, book.Recipes[j].Name, textWidth-numberWidth-24)
+			nameWidth := pdf.Width(pdf.Regular, 12, name)
+
+			page.SetGray(0)
+			page.Text(margin, y, pdf.Regular, 12, name)
+			page.Text(margin+textWidth-numberWidth, y, pdf.Regular, 12, number)
+			page.SetGray(0.6)
+			page.Line(margin+nameWidth+6, y, margin+textWidth-numberWidth-6, y, 0.5)
+			page.Link(margin, y-14, textWidth, entryHeight, starts[j])
+			y += entryHeight
+		}
+	}
+
+	numberPages(doc, 2)
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// writeRecipePages lays recipe out from the top of a new page, adding pages
+// as it runs over, and returns the first.
+func writeRecipePages(doc *pdf.Document, recipe models.Recipe, photos storage.Store) (*pdf.Page, error) {
+	l := &layout{doc: doc, page: doc.AddPage(), y: margin}
+	first := l.page
+
+	l.paragraph(pdf.Bold, 22, 0, recipe.Name)
+	l.y += 4
+
+	var details []string
+	if recipe.Servings > 0 {
+		details = append(details, fmt.Sprintf("Serves %d", recipe.Servings))
+	}
+	if recipe.PrepTime > 0 {
+		details = append(details, "Prep "+recipe.PrepTime.String())
+	}
+	if recipe.CookTime > 0 {
+		details = append(details, "Cook "+recipe.CookTime.String())
+	}
+	var tags []string
+	for _, tag := range recipe.Tags {
+		tags = append(tags, tag.Name)
+	}
+	l.page.SetGray(0.4)
+	if len(details) > 0 {
+		l.paragraph(pdf.Italic, 10, 0, strings.Join(details, " · "))
+	}
+	if len(tags) > 0 {
+		l.paragraph(pdf.Italic, 10, 0, strings.Join(tags, ", "))
+	}
+	l.page.SetGray(0)
+
+	if cover := recipe.Cover(); cover != nil {
+		img, err := loadThumbnail(doc, photos, *cover)
+		if err != nil {
+			return nil, err
+		}
+		if img != nil {
+			h := float64(photoHeight)
+			w := h * float64(img.Width) / float64(img.Height)
+			if w > textWidth {
+				w, h = textWidth, textWidth*float64(img.Height)/float64(img.Width)
+			}
+			l.y += 8
+			if err := l.page.Image(img, margin, l.y, w, h); err != nil {
+				return nil, err
+			}
+			l.y += h + 4
+		}
+	}
+
+	if recipe.Description != "" {
+		l.y += 8
+		l.paragraph(pdf.Regular, 11, 0, recipe.Description)
+	}
+
+	if len(recipe.Ingredients) > 0 {
+		l.heading("Ingredients")
+		for _, ri := range recipe.Ingredients {
+			l.item("•", ingredientLine(ri))
+		}
+	}
+
+	if len(recipe.Steps) > 0 {
+		l.heading("Instructions")
+		for i, step := range recipe.Steps {
+			l.item(fmt.Sprintf("%d.", i+1), step.Text)
+			l.y += 4
+		}
+	}
+
+	if recipe.SourceURL != "" {
+		l.y += 12
+		l.page.SetGray(0.4)
+		l.paragraph(pdf.Italic, 9, 0, "From "+recipe.SourceURL)
+		l.page.SetGray(0)
+	}
+	return first, nil
+}
+
+// loadThumbnail adds photo's thumbnail to doc. It's nil if the file has gone
+// missing, which isn't worth failing the whole PDF over.
+func loadThumbnail(doc *pdf.Document, photos storage.Store, photo models.RecipePhoto) (*pdf.Image, error) {
+	blob, err := photos.Open(photo.ThumbnailKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, err
+	}
+	img, err := doc.JPEG(data)
+	if err != nil {
+		return nil, nil
+	}
+	return img, nil
+}
+
+// numberPages writes the page number at the foot of every page from the
+// from'th on, counting from 1.
+func numberPages(doc *pdf.Document, from int) {
+	for i, page := range doc.Pages() {
+		if i+1 < from {
+			continue
+		}
+		page.SetGray(0.4)
+		centered(page, pdf.LetterHeight-margin/2, pdf.Regular, 9, fmt.Sprint(i+1))
+	}
+}
+
+func centered(page *pdf.Page, y float64, font pdf.Font, size float64, s string) {
+	page.Text((pdf.LetterWidth-pdf.Width(font, size, s))/2, y, font, size, s)
+}
+
+// fit shortens s with an ellipsis until it's no wider than width.
+func fit(font pdf.Font, size float64, s string, width float64) string {
+	if pdf.Width(font, size, s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && pdf.Width(font, size, string(runes)+"…") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "…"
+}
+
+// layout flows text down a recipe's pages, starting another page when one
+// fills up.
+type layout struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64 // the top of the next line
+}
+
+// space makes sure height more points fit on the page, starting a new one
+// if not.
+func (l *layout) space(height float64) {
+	if l.y+height <= pdf.LetterHeight-margin {
+		return
+	}
+	l.page = l.doc.AddPage()
+	l.y = margin
+}
+
+// paragraph writes s wrapped to the text width, indented by indent.
+func (l *layout) paragraph(font pdf.Font, size, indent float64, s string) {
+	leading := size * 1.35
+	for _, line := range pdf.Wrap(font, size, s, textWidth-indent) {
+		l.space(leading)
+		l.y += leading
+		l.page.Text(margin+indent, l.y-size*0.3, font, size, line)
+	}
+}
+
+func (l *layout) heading(s string) {
+	l.y += 14
+	l.space(16 + 2*11*1.35) // keep a heading with the start of what follows
+	l.paragraph(pdf.Bold, 14, 0, s)
+	l.y += 4
+}
+
+// item writes s as a list item, with its marker hanging to the left.
+func (l *layout) item(marker, s string) {
+	const size, indent = 11, 20
+	l.space(size * 1.35)
+	l.page.Text(margin+indent-pdf.Width(pdf.Regular, size, marker)-6, l.y+size*1.35-size*0.3, pdf.Regular, size, marker)
+	l.paragraph(pdf.Regular, size, indent, s)
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/storage"
+)
+
+// RecipeZip bundles a recipe as recipe.json, recipe.jsonld and recipe.md
+// alongside its photos, which the Markdown and JSON-LD link to. Photos are
+// read from photos.
+func RecipeZip(w io.Writer, recipe models.Recipe, photos storage.Store) error {
+	zw := zip.NewWriter(w)
+	if err := writeRecipeFiles(zw, "", recipe, photos); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// BookZip bundles a book as book.json, book.jsonld and book.md, with each
+// recipe in its own numbered folder laid out like RecipeZip.
+func BookZip(w io.Writer, book Book, photos storage.Store) error {
+	zw := zip.NewWriter(w)
+
+	if err := writeFile(zw, "book.json", func(w io.Writer) error { return JSON(w, book) }); err != nil {
+		return err
+	}
+	if err := writeFile(zw, "book.jsonld", func(w io.Writer) error { return JSON(w, BookJSONLD(book)) }); err != nil {
+		return err
+	}
+	if err := writeFile(zw, "book.md", func(w io.Writer) error { return BookMarkdown(w, book) }); err != nil {
+		return err
+	}
+
+	for i, recipe := range book.Recipes {
+		dir := fmt.Sprintf("%02d-%s/", i+1, FileName(recipe.Name))
+		if err := writeRecipeFiles(zw, dir, recipe, photos); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeRecipeFiles(zw *zip.Writer, dir string, recipe models.Recipe, photos storage.Store) error {
+	var images []string
+	for i, photo := range recipe.Photos {
+		name := photoName(photo, i)
+		blob, err := photos.Open(photo.Key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = writeFile(zw, dir+name, func(w io.Writer) error {
+			_, err := io.Copy(w, blob)
+			return err
+		})
+		blob.Close()
+		if err != nil {
+			return err
+		}
+		images = append(images, name)
+	}
+
+	if err := writeFile(zw, dir+"recipe.json", func(w io.Writer) error { return JSON(w, recipe) }); err != nil {
+		return err
+	}
+	if err := writeFile(zw, dir+"recipe.jsonld", func(w io.Writer) error { return JSON(w, RecipeJSONLD(recipe, images)) }); err != nil {
+		return err
+	}
+	return writeFile(zw, dir+"recipe.md", func(w io.Writer) error { return RecipeMarkdown(w, recipe, images) })
+}
+
+func writeFile(zw *zip.Writer, name string, write func(io.Writer) error) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
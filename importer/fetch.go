@@ -0,0 +1,97 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+)
+
+// MaxPageSize is the most of a page we'll read looking for a recipe.
+const MaxPageSize = 5 << 20
+
+// Fetcher gets the web page at a URL.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+// HTTPFetcher fetches pages over the internet. Since the URL comes from a
+// user, it refuses to connect to loopback, private or link-local addresses,
+// so it can't be pointed at the server's own network.
+type HTTPFetcher struct {
+	Client *http.Client
+}
+
+// NewHTTPFetcher returns an HTTPFetcher that gives up on slow sites.
+func NewHTTPFetcher() *HTTPFetcher {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: refusePrivate}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &HTTPFetcher{Client: &http.Client{Transport: transport, Timeout: 15 * time.Second}}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not a web address", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch %s: %w", u.Host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't fetch %s: %s", u.Host, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, MaxPageSize))
+}
+
+var errPrivateAddress = errors.New("refusing to fetch from a private address")
+
+// refusePrivate runs just before each connection, after DNS, so a public
+// name resolving to a private address is caught too.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// FSFetcher serves saved pages from a file system instead of the network,
+// for trying the importer without one. A URL's host and path name the file:
+// https://example.com/pie is read from example.com/pie.html.
+type FSFetcher struct {
+	FS fs.FS
+}
+
+func (f FSFetcher) Fetch(_ context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%q is not a web address", rawURL)
+	}
+	name := path.Join(u.Host, path.Clean("/"+u.Path))
+	if path.Ext(name) == "" {
+		name += ".html"
+	}
+	return fs.ReadFile(f.FS, name)
+}
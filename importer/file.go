@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	// MaxEntrySize is the largest single file read out of an archive, so a
+	// small upload can't unpack into something enormous.
+	MaxEntrySize = 32 << 20
+	// MaxEntries is how many files an archive may hold.
+	MaxEntries = 10000
+	// MaxTotalSize is how much the recipes in an archive, photos included,
+	// may add up to, since they're all held in memory until they're saved.
+	MaxTotalSize = 256 << 20
+)
+
+// ErrUnknownFormat is returned for files that aren't an export we can read.
+var ErrUnknownFormat = errors.New("that file isn't a Paprika, Mealie or Markdown export")
+
+// Item is one recipe found in an export, or why it couldn't be read.
+type Item struct {
+	Source string // the file it came from, within the archive if there is one
+	Recipe Recipe
+	Err    error
+}
+
+// FromFile reads every recipe in an export from another recipe manager:
+//
+//   - Paprika: a .paprikarecipes archive, or a single .paprikarecipe
+//   - Mealie: recipe JSON, alone or as an array, or a zip of such files
+//   - Markdown: a .md file with optional front matter, or a zip of them
+//
+// name is the uploaded file's name, which tells the formats apart. A file
+// that can't be read at all is an error; recipes that can't be read are
+// reported in their Item, so the rest can still be imported.
+func FromFile(name string, r io.ReaderAt, size int64) ([]Item, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".paprikarecipes", ".zip":
+		zr, err := zip.NewReader(r, size)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't open %s: %w", name, err)
+		}
+		return fromZip(zr, MaxTotalSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(io.NewSectionReader(r, 0, size), MaxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxEntrySize {
+		return nil, fmt.Errorf("%s is too large", name)
+	}
+	items, ok := fromEntry(name, data)
+	if !ok {
+		return nil, ErrUnknownFormat
+	}
+	return items, nil
+}
+
+// fromZip reads the recipes in an archive, giving up once they add up to
+// more than limit bytes.
+func fromZip(zr *zip.Reader, limit int) ([]Item, error) {
+	if len(zr.File) > MaxEntries {
+		return nil, fmt.Errorf("the archive has more than %d files", MaxEntries)
+	}
+
+	var items []Item
+	total := 0
+	for _, f := range zr.File {
+		// folders, and the metadata macOS adds to zips it makes
+		if f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") || strings.HasPrefix(path.Base(f.Name), ".") {
+			continue
+		}
+		if !known(f.Name) {
+			continue // photos and anything else alongside the recipes
+		}
+
+		data, err := readEntry(f)
+		if err != nil {
+			items = append(items, Item{Source: f.Name, Err: err})
+			continue
+		}
+		found, _ := fromEntry(f.Name, data)
+		for _, item := range found {
+			total += item.Recipe.size()
+		}
+		if total > limit {
+			return nil, fmt.Errorf("the recipes in the archive add up to more than %d MB", limit>>20)
+		}
+		items = append(items, found...)
+	}
+	if len(items) == 0 {
+		return nil, ErrUnknownFormat
+	}
+	return items, nil
+}
+
+func readEntry(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > MaxEntrySize {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, MaxEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxEntrySize {
+		return nil, fmt.Errorf("%s is too large", f.Name)
+	}
+	return data, nil
+}
+
+func known(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".paprikarecipe", ".json", ".md", ".markdown":
+		return true
+	}
+	return false
+}
+
+// fromEntry reads the recipes in one file, going by its extension.
+func fromEntry(name string, data []byte) ([]Item, bool) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".paprikarecipe":
+		recipe, err := fromPaprika(data)
+		return []Item{{Source: name, Recipe: recipe, Err: err}}, true
+	case ".json":
+		return fromMealie(name, data), true
+	case ".md", ".markdown":
+		recipe, err := fromMarkdown(name, data)
+		return []Item{{Source: name, Recipe: recipe, Err: err}}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fromTestdata reads an export saved in testdata.
+func fromTestdata(t *testing.T, name string) []Item {
+	t.Helper()
+	f, err := os.Open(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := FromFile(name, f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+// checkItems compares the report for each recipe in an export: the recipe
+// read from good, and an error saying why bad couldn't be.
+func checkItems(t *testing.T, items []Item, good Item, bad Item) {
+	t.Helper()
+	if len(items) != 2 {
+		t.Fatalf("got %d items, want 2: %+v", len(items), items)
+	}
+	if items[0].Err != nil {
+		t.Errorf("%s: %v", items[0].Source, items[0].Err)
+	}
+	if !reflect.DeepEqual(items[0], good) {
+		t.Errorf("got\n%+v\nwant\n%+v", items[0], good)
+	}
+	if items[1].Source != bad.Source || items[1].Err == nil || items[1].Err.Error() != bad.Err.Error() {
+		t.Errorf("got %s: %v, want %s: %v", items[1].Source, items[1].Err, bad.Source, bad.Err)
+	}
+}
+
+func TestFromFilePaprika(t *testing.T) {
+	checkItems(t, fromTestdata(t, "export.paprikarecipes"),
+		Item{
+			Source: "Banana Bread.paprikarecipe",
+			Recipe: Recipe{
+				Name:         "Banana Bread",
+				Description:  "Uses up brown bananas.\n\nFreezes well.",
+				Ingredients:  []string{"3 ripe bananas", "2 cups flour", "1 tsp baking soda"},
+				Instructions: []string{"Mash the bananas.", "Stir in the rest.", "Bake for an hour."},
+				Servings:     1,
+				PrepTime:     15 * time.Minute,
+				CookTime:     time.Hour,
+				Categories:   []string{"Baking"},
+				SourceURL:    "https://example.com/banana-bread",
+				Photos:       [][]byte{[]byte("image")},
+			},
+		},
+		Item{Source: "Broken.paprikarecipe", Err: errors.New("not a Paprika recipe: gzip: invalid header")},
+	)
+}
+
+func TestFromFileMealie(t *testing.T) {
+	items := fromTestdata(t, "mealie.zip")
+	checkItems(t, items,
+		Item{
+			Source: "recipes.json",
+			Recipe: Recipe{
+				Name:         "Tomato Soup",
+				Description:  "Quick and warming.",
+				Ingredients:  []string{"2 tbsp olive oil", "1.5 kg tomatoes chopped", "1 onion"},
+				Instructions: []string{"Base:", "Soften the onion in the oil.", "Add the tomatoes and simmer."},
+				Servings:     4,
+				PrepTime:     10 * time.Minute,
+				CookTime:     25 * time.Minute,
+				Categories:   []string{"Soup"},
+				Keywords:     []string{"Vegetarian"},
+				SourceURL:    "https://example.com/tomato-soup",
+			},
+		},
+		Item{Source: "recipes.json", Err: errors.New("recipe 2 has no name")},
+	)
+}
+
+func TestFromFileMarkdown(t *testing.T) {
+	checkItems(t, fromTestdata(t, "markdown.zip"),
+		Item{
+			Source: "recipes/pancakes.md",
+			Recipe: Recipe{
+				Name:         "Pancakes",
+				Description:  "Fluffy American-style pancakes.",
+				Ingredients:  []string{"1 1/2 cups flour", "1 1/4 cups milk", "1 egg"},
+				Instructions: []string{"Whisk everything together.", "Cook on a hot griddle until bubbles form,\nthen flip."},
+				Servings:     4,
+				PrepTime:     5 * time.Minute,
+				CookTime:     15 * time.Minute,
+				Keywords:     []string{"breakfast", "quick"},
+			},
+		},
+		Item{Source: "recipes/notes.md", Err: errors.New("no ingredients or instructions found")},
+	)
+}
+
+func TestFromZipLimitsTotalSize(t *testing.T) {
+	zr, err := zip.OpenReader(filepath.Join("testdata", "export.paprikarecipes"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	if _, err := fromZip(&zr.Reader, MaxTotalSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fromZip(&zr.Reader, 100); err == nil {
+		t.Error("an archive larger than the limit was read")
+	}
+}
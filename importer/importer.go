@@ -0,0 +1,58 @@
+// Package importer reads recipes written down elsewhere so they can be
+// saved here. Web pages are read through the schema.org Recipe JSON-LD that
+// most recipe sites embed for search engines; exports from other recipe
+// managers are read by FromFile.
+package importer
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoRecipe is returned when a page doesn't describe a recipe.
+var ErrNoRecipe = errors.New("couldn't find a recipe on that page")
+
+// Recipe is a recipe as found elsewhere, before it's been reviewed and saved.
+type Recipe struct {
+	Name         string
+	Description  string
+	Ingredients  []string // whole lines: "2 cups flour, sifted"
+	Instructions []string // one step per entry; section headings included
+	Servings     int      // 0 when unknown
+	PrepTime     time.Duration
+	CookTime     time.Duration
+	Cuisines     []string
+	Categories   []string
+	Keywords     []string
+	SourceURL    string
+	Photos       [][]byte // image files that came with the recipe
+}
+
+// size is about how many bytes the recipe holds in memory.
+func (r Recipe) size() int {
+	n := len(r.Name) + len(r.Description) + len(r.SourceURL)
+	for _, list := range [][]string{r.Ingredients, r.Instructions, r.Cuisines, r.Categories, r.Keywords} {
+		for _, s := range list {
+			n += len(s)
+		}
+	}
+	for _, photo := range r.Photos {
+		n += len(photo)
+	}
+	return n
+}
+
+// FromURL fetches the page at url and reads the recipe on it.
+func FromURL(ctx context.Context, fetcher Fetcher, url string) (Recipe, error) {
+	page, err := fetcher.Fetch(ctx, url)
+	if err != nil {
+		return Recipe{}, err
+	}
+	recipe, err := FromHTML(page)
+	if err != nil {
+		return Recipe{}, err
+	}
+	recipe.SourceURL = url
+	return recipe, nil
+}
@@ -0,0 +1,215 @@
+package importer
+
+import (
+	"encoding/json"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	jsonLDScript = regexp.MustCompile(`(?is)<script[^>]*type\s*=\s*["']?application/ld\+json["']?[^>]*>(.*?)</script>`)
+	tag          = regexp.MustCompile(`<[^>]*>`)
+	lineBreak    = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</li>`)
+	firstNumber  = regexp.MustCompile(`\d+`)
+	isoDuration  = regexp.MustCompile(`(?i)^P(?:(\d+)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+	wordDuration = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*(days?|d|hours?|hrs?|h|minutes?|mins?|m)\b`)
+)
+
+// FromHTML reads the recipe from a page's schema.org Recipe JSON-LD. The
+// Recipe can be at the top level of a script, in a list, in an @graph or
+// nested in another item, as sites do all of these. Scripts that aren't
+// valid JSON are skipped.
+func FromHTML(page []byte) (Recipe, error) {
+	for _, match := range jsonLDScript.FindAllSubmatch(page, -1) {
+		var doc any
+		if err := json.Unmarshal(match[1], &doc); err != nil {
+			continue
+		}
+		if item := findRecipe(doc); item != nil {
+			return fromJSONLD(item), nil
+		}
+	}
+	return Recipe{}, ErrNoRecipe
+}
+
+func findRecipe(v any) map[string]any {
+	switch v := v.(type) {
+	case map[string]any:
+		for _, t := range list(v["@type"]) {
+			if t == "Recipe" || strings.HasSuffix(t, "/Recipe") {
+				return v
+			}
+		}
+		for _, child := range v {
+			if item := findRecipe(child); item != nil {
+				return item
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if item := findRecipe(child); item != nil {
+				return item
+			}
+		}
+	}
+	return nil
+}
+
+func fromJSONLD(item map[string]any) Recipe {
+	recipe := Recipe{
+		Name:         text(item["name"]),
+		Description:  text(item["description"]),
+		Instructions: steps(item["recipeInstructions"]),
+		Servings:     servings(item["recipeYield"]),
+		PrepTime:     duration(item["prepTime"]),
+		CookTime:     duration(item["cookTime"]),
+		Cuisines:     list(item["recipeCuisine"]),
+		Categories:   list(item["recipeCategory"]),
+	}
+
+	ingredients := item["recipeIngredient"]
+	if ingredients == nil {
+		// the older name for the property
+		ingredients = item["ingredients"]
+	}
+	if line, ok := ingredients.(string); ok {
+		// one ingredient, so its commas aren't separators
+		ingredients = []any{line}
+	}
+	for _, line := range list(ingredients) {
+		if line = clean(line); line != "" {
+			recipe.Ingredients = append(recipe.Ingredients, line)
+		}
+	}
+
+	// Some sites only give the total time.
+	if total := duration(item["totalTime"]); recipe.CookTime == 0 && total > recipe.PrepTime {
+		recipe.CookTime = total - recipe.PrepTime
+	}
+	return recipe
+}
+
+// steps flattens recipeInstructions, which may be one block of text, a list
+// of strings, or HowToSteps grouped into HowToSections.
+func steps(v any) []string {
+	var out []string
+	switch v := v.(type) {
+	case string:
+		for _, line := range strings.Split(lineBreak.ReplaceAllString(v, "\n"), "\n") {
+			if line = clean(line); line != "" {
+				out = append(out, line)
+			}
+		}
+	case []any:
+		for _, step := range v {
+			out = append(out, steps(step)...)
+		}
+	case map[string]any:
+		if children, ok := v["itemListElement"]; ok {
+			if name := text(v["name"]); name != "" {
+				out = append(out, name+":")
+			}
+			return append(out, steps(children)...)
+		}
+		if title := text(v["title"]); title != "" {
+			// Mealie's section headings
+			out = append(out, title+":")
+		}
+		step := text(v["text"])
+		if step == "" {
+			step = text(v["name"])
+		}
+		if step != "" {
+			out = append(out, step)
+		}
+	}
+	return out
+}
+
+// list reads a property that may be a single value or a list of them.
+// Single strings with commas ("Italian, Mediterranean") are split.
+func list(v any) []string {
+	switch v := v.(type) {
+	case string:
+		var out []string
+		for _, s := range strings.Split(v, ",") {
+			if s = clean(s); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}
+	case []any:
+		var out []string
+		for _, item := range v {
+			switch item := item.(type) {
+			case string:
+				if s := clean(item); s != "" {
+					out = append(out, s)
+				}
+			case float64:
+				out = append(out, strconv.FormatFloat(item, 'f', -1, 64))
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// servings reads the number of servings from a yield like "4", "Serves 4"
+// or ["4", "4 slices"].
+func servings(v any) int {
+	for _, yield := range list(v) {
+		if n, err := strconv.Atoi(firstNumber.FindString(yield)); err == nil && n > 0 {
+			return n
+		}
+	}
+	return 0
+}
+
+func text(v any) string {
+	s, _ := v.(string)
+	return clean(s)
+}
+
+// clean turns a JSON-LD string into plain text. Sites often leave HTML and
+// entities in them.
+func clean(s string) string {
+	s = html.UnescapeString(tag.ReplaceAllString(html.UnescapeString(s), ""))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// duration reads an ISO 8601 duration such as "PT1H30M", or failing that
+// one written out like "1 hr 30 mins", as other recipe managers store them.
+func duration(v any) time.Duration {
+	s, _ := v.(string)
+	s = strings.TrimSpace(s)
+	var d time.Duration
+	if m := isoDuration.FindStringSubmatch(s); m != nil {
+		for i, unit := range []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second} {
+			if n, err := strconv.ParseFloat(m[i+1], 64); err == nil {
+				d += time.Duration(n * float64(unit))
+			}
+		}
+		return d
+	}
+	for _, m := range wordDuration.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		unit := time.Minute
+		switch strings.ToLower(m[2])[0] {
+		case 'd':
+			unit = 24 * time.Hour
+		case 'h':
+			unit = time.Hour
+		}
+		d += time.Duration(n * float64(unit))
+	}
+	return d
+}
@@ -0,0 +1,105 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// saved serves the pages in testdata/example.com.
+var saved = FSFetcher{FS: os.DirFS("testdata")}
+
+func TestFromURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want Recipe
+	}{
+		{
+			// In an @graph beside the page, after a script that isn't JSON,
+			// with HowToSteps and a yield written as a string.
+			name: "graph",
+			url:  "https://example.com/apple-pie",
+			want: Recipe{
+				Name:        "Apple Pie",
+				Description: "A double-crust pie with plenty of cinnamon.",
+				Ingredients: []string{"2 pie crusts", "6 apples, peeled and sliced", "3/4 cup sugar", "1 tsp cinnamon"},
+				Instructions: []string{
+					"Heat the oven to 220°C.",
+					"Toss the apples with the sugar and cinnamon.",
+					"Fill the crust, cover and bake for an hour.",
+				},
+				Servings:   8,
+				PrepTime:   30 * time.Minute,
+				CookTime:   75 * time.Minute,
+				Cuisines:   []string{"American"},
+				Categories: []string{"Dessert"},
+				SourceURL:  "https://example.com/apple-pie",
+			},
+		},
+		{
+			// Typed as more than one thing, with HowToSections and a yield
+			// given as a list.
+			name: "sections",
+			url:  "https://example.com/sourdough",
+			want: Recipe{
+				Name:        "Country Sourdough",
+				Ingredients: []string{"900 g bread flour", "100 g whole wheat flour", "750 g water", "20 g salt"},
+				Instructions: []string{
+					"The night before:",
+					"Feed the starter.",
+					"Bake day:",
+					"Mix the dough and let it rest.",
+					"Shape, proof and bake.",
+				},
+				Servings:  2,
+				PrepTime:  time.Hour,
+				CookTime:  45 * time.Minute,
+				SourceURL: "https://example.com/sourdough",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromURL(context.Background(), saved, tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FromURL(%q) =\n%+v\nwant\n%+v", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromURLWithoutRecipe(t *testing.T) {
+	if _, err := FromURL(context.Background(), saved, "https://example.com/about"); !errors.Is(err, ErrNoRecipe) {
+		t.Errorf("err = %v, want ErrNoRecipe", err)
+	}
+	if _, err := FromURL(context.Background(), saved, "https://example.com/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("err = %v, want a missing file", err)
+	}
+}
+
+func TestServings(t *testing.T) {
+	tests := []struct {
+		yield any
+		want  int
+	}{
+		{"4", 4},
+		{"Serves 6", 6},
+		{float64(12), 12},
+		{[]any{"2", "2 loaves"}, 2},
+		{[]any{"a dozen", "12 cookies"}, 12},
+		{"", 0},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := servings(tt.yield); got != tt.want {
+			t.Errorf("servings(%#v) = %d, want %d", tt.yield, got, tt.want)
+		}
+	}
+}
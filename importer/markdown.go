@@ -0,0 +1,264 @@
+package importer
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+)
+
+var (
+	heading        = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	listItem       = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(.*)$`)
+	image          = regexp.MustCompile(`^!\[[^\]]*\]\([^)]*\)$`)
+	sourceLine     = regexp.MustCompile(`^(?i:from|source):?\s*<?(https?://[^>\s]+)>?$`)
+	frontMatterKey = regexp.MustCompile(`^([A-Za-z_ ]+):\s*(.*)$`)
+)
+
+// fromMarkdown reads a recipe written in Markdown. Front matter between
+// "---" lines may give its details as "key: value" pairs. In the body, the
+// first "#" heading names the recipe, sections headed Ingredients and
+// Instructions (or Directions, Method, Steps) hold those, and other text is
+// the description. Recipes exported as Markdown from here read back in.
+func fromMarkdown(name string, data []byte) (Recipe, error) {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	meta, body := frontMatter(text)
+
+	recipe := Recipe{
+		Name:        first(meta, "title", "name"),
+		Description: first(meta, "description", "summary"),
+		Servings:    servings(first(meta, "servings", "serves", "yield", "recipe_yield")),
+		PrepTime:    duration(first(meta, "prep_time", "prep", "preptime")),
+		CookTime:    duration(first(meta, "cook_time", "cook", "cooktime")),
+		Cuisines:    all(meta, "cuisine", "cuisines"),
+		Categories:  all(meta, "category", "categories", "course"),
+		Keywords:    all(meta, "tags", "keywords"),
+		SourceURL:   first(meta, "source", "source_url", "url"),
+	}
+	if total := duration(first(meta, "total_time", "total")); recipe.CookTime == 0 && total > recipe.PrepTime {
+		recipe.CookTime = total - recipe.PrepTime
+	}
+
+	section := "description"
+	var description, paragraph []string
+	inStep := false // the last line was part of a numbered or bulleted step
+	endParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+		joined := strings.Join(paragraph, " ")
+		if section == "instructions" {
+			recipe.Instructions = append(recipe.Instructions, joined)
+		} else {
+			description = append(description, joined)
+		}
+		paragraph = nil
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimSpace(line)
+
+		if m := heading.FindStringSubmatch(trimmed); m != nil {
+			endParagraph()
+			inStep = false
+			title := m[2]
+			lower := strings.ToLower(title)
+			switch {
+			case len(m[1]) == 1 && recipe.Name == "" && section == "description" && len(description) == 0:
+				recipe.Name = title
+			case strings.Contains(lower, "ingredient"):
+				section = "ingredients"
+			case containsAny(lower, "instruction", "direction", "method", "step", "preparation"):
+				section = "instructions"
+			case section == "instructions":
+				recipe.Instructions = append(recipe.Instructions, title+":")
+			case section == "ingredients":
+				// a heading within the ingredients, "For the crust"
+			default:
+				section = "description"
+				description = append(description, title)
+			}
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			endParagraph()
+			inStep = false
+			continue
+		case image.MatchString(trimmed):
+			continue
+		case sourceLine.MatchString(trimmed):
+			endParagraph()
+			recipe.SourceURL = sourceLine.FindStringSubmatch(trimmed)[1]
+			continue
+		}
+
+		if section == "description" {
+			if details(trimmed, &recipe) {
+				endParagraph()
+				continue
+			}
+			if tags, ok := strings.CutPrefix(trimmed, "Tags:"); ok {
+				endParagraph()
+				recipe.Keywords = append(recipe.Keywords, list(tags)...)
+				continue
+			}
+		}
+
+		item := listItem.FindStringSubmatch(line)
+		switch section {
+		case "ingredients":
+			if item != nil {
+				trimmed = item[1]
+			}
+			if trimmed = clean(trimmed); trimmed != "" {
+				recipe.Ingredients = append(recipe.Ingredients, trimmed)
+			}
+		case "instructions":
+			switch {
+			case item != nil:
+				endParagraph()
+				recipe.Instructions = append(recipe.Instructions, clean(item[1]))
+				inStep = true
+			case inStep && line != trimmed:
+				// an indented line carries on the step above
+				last := len(recipe.Instructions) - 1
+				recipe.Instructions[last] += "\n" + clean(trimmed)
+			default:
+				paragraph = append(paragraph, trimmed)
+			}
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	endParagraph()
+
+	if recipe.Name == "" {
+		recipe.Name = strings.TrimSuffix(path.Base(name), path.Ext(name))
+	}
+	if recipe.Description == "" {
+		recipe.Description = strings.Join(description, "\n\n")
+	}
+	if len(recipe.Ingredients) == 0 && len(recipe.Instructions) == 0 {
+		return recipe, errors.New("no ingredients or instructions found")
+	}
+	return recipe, nil
+}
+
+// details reads a line like "Serves 8 · Prep 30 min · Cook 1 hr", as
+// Markdown exported from here has. It reports false, changing nothing, for
+// any other line.
+func details(line string, recipe *Recipe) bool {
+	parts := strings.Split(line, " · ")
+	found := *recipe
+	for _, part := range parts {
+		label, value, _ := strings.Cut(part, " ")
+		switch strings.ToLower(label) {
+		case "serves":
+			found.Servings = servings(value)
+			if found.Servings == 0 {
+				return false
+			}
+		case "prep":
+			found.PrepTime = duration(value)
+			if found.PrepTime == 0 {
+				return false
+			}
+		case "cook":
+			found.CookTime = duration(value)
+			if found.CookTime == 0 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	*recipe = found
+	return true
+}
+
+// frontMatter splits the "---" fenced block at the start of text, if any,
+// from the rest. Values are lists: "tags: [a, b]" and "tags:" followed by
+// "- a" lines are both read, and single values are lists of one.
+func frontMatter(text string) (map[string][]string, string) {
+	meta := map[string][]string{}
+	if !strings.HasPrefix(text, "---\n") {
+		return meta, text
+	}
+	block, body, ok := strings.Cut(text[len("---\n"):], "\n---")
+	if !ok {
+		return meta, text
+	}
+	// the rest of the closing fence's line
+	if _, after, ok := strings.Cut(body, "\n"); ok {
+		body = after
+	} else {
+		body = ""
+	}
+
+	var key string
+	for _, line := range strings.Split(block, "\n") {
+		if item := listItem.FindStringSubmatch(line); item != nil && key != "" {
+			meta[key] = append(meta[key], unquote(item[1]))
+			continue
+		}
+		m := frontMatterKey.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(m[1]), " ", "_"))
+		value := strings.TrimSpace(m[2])
+		switch {
+		case value == "":
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, v := range strings.Split(value[1:len(value)-1], ",") {
+				if v = unquote(v); v != "" {
+					meta[key] = append(meta[key], v)
+				}
+			}
+		default:
+			meta[key] = append(meta[key], unquote(value))
+		}
+	}
+	return meta, body
+}
+
+func unquote(s string) string {
+	return strings.Trim(strings.TrimSpace(s), `"'`)
+}
+
+// first returns the first value under any of keys.
+func first(meta map[string][]string, keys ...string) string {
+	for _, key := range keys {
+		if values := meta[key]; len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// all returns the values under every one of keys. A single value with
+// commas, "tags: a, b", is split.
+func all(meta map[string][]string, keys ...string) []string {
+	var out []string
+	for _, key := range keys {
+		values := meta[key]
+		if len(values) == 1 {
+			out = append(out, list(values[0])...)
+		} else {
+			out = append(out, values...)
+		}
+	}
+	return out
+}
+
+func containsAny(s string, substrs ...string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// fromMealie reads recipes from Mealie's JSON: one recipe, an array of
+// them, or an object with a "recipes" array. Mealie's recipes follow
+// schema.org's names, but ingredients, categories and tags are objects.
+func fromMealie(name string, data []byte) []Item {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []Item{{Source: name, Err: fmt.Errorf("not valid JSON: %w", err)}}
+	}
+
+	var found []any
+	switch doc := doc.(type) {
+	case []any:
+		found = doc
+	case map[string]any:
+		if recipes, ok := doc["recipes"].([]any); ok {
+			found = recipes
+		} else {
+			found = []any{doc}
+		}
+	}
+	if len(found) == 0 {
+		return []Item{{Source: name, Err: fmt.Errorf("no recipes in the file")}}
+	}
+
+	items := make([]Item, len(found))
+	for i, v := range found {
+		items[i].Source = name
+		item, ok := v.(map[string]any)
+		if !ok || text(item["name"]) == "" {
+			items[i].Err = fmt.Errorf("recipe %d has no name", i+1)
+			continue
+		}
+		items[i].Recipe = fromMealieRecipe(item)
+	}
+	return items
+}
+
+func fromMealieRecipe(item map[string]any) Recipe {
+	recipe := Recipe{
+		Name:         text(item["name"]),
+		Description:  text(item["description"]),
+		Instructions: steps(item["recipeInstructions"]),
+		Servings:     servings(item["recipeYield"]),
+		PrepTime:     duration(item["prepTime"]),
+		CookTime:     duration(item["cookTime"]),
+		Categories:   names(item["recipeCategory"]),
+		Keywords:     names(item["tags"]),
+		SourceURL:    text(item["orgURL"]),
+	}
+	if recipe.Servings == 0 {
+		recipe.Servings = servings(item["recipeServings"])
+	}
+	if recipe.CookTime == 0 {
+		// older versions call it performTime
+		recipe.CookTime = duration(item["performTime"])
+	}
+	if total := duration(item["totalTime"]); recipe.CookTime == 0 && total > recipe.PrepTime {
+		recipe.CookTime = total - recipe.PrepTime
+	}
+
+	ingredients, _ := item["recipeIngredient"].([]any)
+	for _, v := range ingredients {
+		if line := mealieIngredient(v); line != "" {
+			recipe.Ingredients = append(recipe.Ingredients, line)
+		}
+	}
+	return recipe
+}
+
+// mealieIngredient writes an ingredient as a line. Mealie keeps what was
+// typed when it has it, and otherwise the parsed parts.
+func mealieIngredient(v any) string {
+	switch v := v.(type) {
+	case string:
+		return clean(v)
+	case map[string]any:
+		for _, key := range []string{"originalText", "display"} {
+			if line := text(v[key]); line != "" {
+				return line
+			}
+		}
+		var parts []string
+		if q, ok := v["quantity"].(float64); ok && q > 0 {
+			parts = append(parts, strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", q), "0"), "."))
+		}
+		for _, key := range []string{"unit", "food"} {
+			if unit, ok := v[key].(map[string]any); ok {
+				parts = append(parts, text(unit["name"]))
+			}
+		}
+		parts = append(parts, text(v["note"]))
+		return strings.Join(nonEmpty(parts...), " ")
+	}
+	return ""
+}
+
+// names reads a list of strings or of objects with a "name".
+func names(v any) []string {
+	values, ok := v.([]any)
+	if !ok {
+		return list(v)
+	}
+	var out []string
+	for _, value := range values {
+		switch value := value.(type) {
+		case string:
+			out = append(out, nonEmpty(clean(value))...)
+		case map[string]any:
+			out = append(out, nonEmpty(text(value["name"]))...)
+		}
+	}
+	return out
+}
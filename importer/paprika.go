@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// paprikaRecipe is the JSON in each of Paprika's .paprikarecipe files.
+type paprikaRecipe struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Ingredients string   `json:"ingredients"` // a line each
+	Directions  string   `json:"directions"`
+	Notes       string   `json:"notes"`
+	Servings    string   `json:"servings"`
+	PrepTime    string   `json:"prep_time"`
+	CookTime    string   `json:"cook_time"`
+	TotalTime   string   `json:"total_time"`
+	Categories  []string `json:"categories"`
+	SourceURL   string   `json:"source_url"`
+	PhotoData   string   `json:"photo_data"` // base64
+	Photos      []struct {
+		Data string `json:"data"` // base64
+	} `json:"photos"`
+}
+
+// fromPaprika reads a .paprikarecipe file, which is gzipped JSON.
+func fromPaprika(data []byte) (Recipe, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return Recipe{}, fmt.Errorf("not a Paprika recipe: %w", err)
+	}
+	defer gz.Close()
+	raw, err := io.ReadAll(io.LimitReader(gz, MaxEntrySize+1))
+	if err != nil {
+		return Recipe{}, fmt.Errorf("not a Paprika recipe: %w", err)
+	}
+	if len(raw) > MaxEntrySize {
+		return Recipe{}, fmt.Errorf("the recipe is too large")
+	}
+
+	var p paprikaRecipe
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Recipe{}, fmt.Errorf("not a Paprika recipe: %w", err)
+	}
+	if strings.TrimSpace(p.Name) == "" {
+		return Recipe{}, fmt.Errorf("the recipe has no name")
+	}
+
+	recipe := Recipe{
+		Name:         clean(p.Name),
+		Description:  strings.TrimSpace(strings.Join(nonEmpty(p.Description, p.Notes), "\n\n")),
+		Ingredients:  lines(p.Ingredients),
+		Instructions: lines(p.Directions),
+		Servings:     servings(p.Servings),
+		PrepTime:     duration(p.PrepTime),
+		CookTime:     duration(p.CookTime),
+		Categories:   p.Categories,
+		SourceURL:    p.SourceURL,
+	}
+	if total := duration(p.TotalTime); recipe.CookTime == 0 && total > recipe.PrepTime {
+		recipe.CookTime = total - recipe.PrepTime
+	}
+
+	// photo_data is the main photo; photos are any others.
+	for _, encoded := range append([]string{p.PhotoData}, photoData(p)...) {
+		if encoded == "" {
+			continue
+		}
+		if photo, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			recipe.Photos = append(recipe.Photos, photo)
+		}
+	}
+	return recipe, nil
+}
+
+func photoData(p paprikaRecipe) []string {
+	var out []string
+	for _, photo := range p.Photos {
+		out = append(out, photo.Data)
+	}
+	return out
+}
+
+// lines splits text into its non-empty lines.
+func lines(text string) []string {
+	var out []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
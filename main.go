@@ -10,8 +10,12 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"github.com/imsteev/recipebook/controllers"
+	"github.com/imsteev/recipebook/importer"
 	"github.com/imsteev/recipebook/middleware"
 	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/nutrition"
+	"github.com/imsteev/recipebook/search"
+	"github.com/imsteev/recipebook/storage"
 	"github.com/imsteev/recipebook/views"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -47,11 +51,56 @@ func main() {
 		&models.Recipe{},
 		&models.Ingredient{},
 		&models.RecipeIngredient{},
+		&models.RecipeStep{},
+		&models.RecipeRevision{},
+		&models.RecipePhoto{},
 		&models.RecipeBook{},
 		&models.RecipeBookSharedLink{},
+		&models.RecipeBookRecipe{},
+		&models.RecipeBookMember{},
+		&models.RecipeBookGift{},
+		&models.RecipeBookTransfer{},
+		&models.ShoppingList{},
+		&models.ShoppingListItem{},
+		&models.MealPlan{},
+		&models.RecipeMessage{},
+		&models.PantryItem{},
+		&models.CookedRecipe{},
 	); err != nil {
 		log.Fatal("failed to migrate database")
 	}
+	if err := models.MigrateIngredientQuantities(db); err != nil {
+		log.Fatal("failed to move ingredient quantities onto recipes")
+	}
+	if err := models.RenormalizeIngredients(db); err != nil {
+		log.Fatal("failed to update the ingredient catalog")
+	}
+	if err := models.MigrateInstructions(db); err != nil {
+		log.Fatal("failed to move recipe instructions into steps")
+	}
+	if err := models.MigrateVariantOverrides(db); err != nil {
+		log.Fatal("failed to record what variants override")
+	}
+	if err := models.MigratePantryLists(db); err != nil {
+		log.Fatal("failed to move saved pantry lists into pantry items")
+	}
+	if err := search.ReindexMissing(db); err != nil {
+		log.Fatal("failed to index recipes for search")
+	}
+
+	photoDir := os.Getenv("PHOTO_DIR")
+	if photoDir == "" {
+		photoDir = "./data/photos"
+	}
+	photoStore, err := storage.NewLocal(photoDir)
+	if err != nil {
+		log.Fatal("failed to open the photo store")
+	}
+
+	nutrients, err := nutrition.Bundled()
+	if err != nil {
+		log.Fatal("failed to load the nutrient table")
+	}
 
 	// TODO: store sessions in the database?
 	store = sessions.NewCookieStore([]byte(os.Getenv("SESSION_SECRET")))
@@ -71,10 +120,21 @@ func main() {
 
 	// Controllers
 	var (
-		engine               = views.NewEngine("base.html")
+		engine               = views.NewEngine("base.html", "comments.html", "tags.html", "steps.html", "diff.html")
 		authController       = controllers.AuthController{DB: db, Engine: engine, Store: store}
-		recipeController     = controllers.RecipeController{DB: db, Engine: engine, Store: store}
+		recipeController     = controllers.RecipeController{DB: db, Engine: engine, Store: store, Photos: photoStore, Nutrients: nutrients}
 		recipebookController = controllers.RecipebookController{DB: db, Engine: engine, Store: store}
+		userController       = controllers.UserController{DB: db, Engine: engine}
+		shoppingController   = controllers.ShoppingListController{DB: db, Engine: engine}
+		mealPlanController   = controllers.MealPlanController{DB: db, Engine: engine}
+		giftController       = controllers.GiftController{DB: db, Engine: engine}
+		commentsController   = controllers.RecipeCommentsController{DB: db, Engine: engine}
+		cookController       = controllers.CookController{DB: db, Engine: engine}
+		pantryController     = controllers.PantryController{DB: db, Engine: engine}
+		photoController      = controllers.PhotoController{DB: db, Photos: photoStore}
+		importController     = controllers.ImportController{DB: db, Engine: engine, Fetcher: importer.NewHTTPFetcher(), Photos: photoStore}
+		exportController     = controllers.ExportController{DB: db, Photos: photoStore}
+		revisionController   = controllers.RevisionController{DB: db, Engine: engine}
 	)
 	router.HandleFunc("/", authController.LandingPage).Methods("GET")
 	router.HandleFunc("/login", authController.LoginPage).Methods("GET")
@@ -83,18 +143,69 @@ func main() {
 	router.HandleFunc("/signup", authController.SignupPage).Methods("GET")
 	router.HandleFunc("/signup", authController.Signup).Methods("POST")
 	router.HandleFunc("/recipebooks/slug/{slug}", recipebookController.GetRecipeBookBySlug).Methods("GET")
+	router.HandleFunc("/recipebooks/slug/{slug}/recipes/{recipeID}", recipebookController.GetSharedRecipe).Methods("GET")
+	router.HandleFunc("/recipebooks/slug/{slug}/recipes/{recipeID}/comments", commentsController.CreateGuestComment).Methods("POST")
+	router.HandleFunc("/recipebooks/slug/{slug}/photos/{id}", photoController.GetSharedPhoto).Methods("GET")
+	router.HandleFunc("/recipebooks/slug/{slug}/photos/{id}/{size:thumbnail}", photoController.GetSharedPhoto).Methods("GET")
 
 	privateRouter.HandleFunc("/recipes", recipeController.ListRecipes).Methods("GET")
 	privateRouter.HandleFunc("/recipes", recipeController.CreateRecipe).Methods("POST")
 	privateRouter.HandleFunc("/recipes/new", recipeController.NewRecipe).Methods("GET")
+	privateRouter.HandleFunc("/recipes/import", importController.ImportPage).Methods("GET")
+	privateRouter.HandleFunc("/recipes/import", importController.ImportFromURL).Methods("POST")
+	privateRouter.HandleFunc("/recipes/import/file", importController.ImportFile).Methods("POST")
 	privateRouter.HandleFunc("/recipes/{id}", recipeController.GetRecipe).Methods("GET")
+	privateRouter.HandleFunc("/recipes/{id}/cook", recipeController.CookRecipe).Methods("GET")
 	privateRouter.HandleFunc("/recipes/{id}/edit", recipeController.EditRecipe).Methods("GET")
 	privateRouter.HandleFunc("/recipes/{id}/edit", recipeController.UpdateRecipe).Methods("POST")
+	privateRouter.HandleFunc("/recipes/{id}/export", exportController.ExportRecipe).Methods("GET")
+	privateRouter.HandleFunc("/recipes/{id}/variants", recipeController.CreateVariant).Methods("POST")
+	privateRouter.HandleFunc("/recipes/{id}/compare", recipeController.CompareVariant).Methods("GET")
+	privateRouter.HandleFunc("/recipes/{id}/history", revisionController.RecipeHistory).Methods("GET")
+	privateRouter.HandleFunc("/recipes/{id}/history/{number:[0-9]+}", revisionController.CompareRevisions).Methods("GET")
+	privateRouter.HandleFunc("/recipes/{id}/history/{number:[0-9]+}/restore", revisionController.RestoreRevision).Methods("POST")
+	privateRouter.HandleFunc("/recipebooks/slug/{slug}/recipes/{recipeID}/fork", recipeController.ForkRecipe).Methods("POST")
+	privateRouter.HandleFunc("/recipes/{id}/comments", commentsController.CreateComment).Methods("POST")
+	privateRouter.HandleFunc("/photos/{id}", photoController.GetPhoto).Methods("GET")
+	privateRouter.HandleFunc("/photos/{id}/{size:thumbnail}", photoController.GetPhoto).Methods("GET")
+	privateRouter.HandleFunc("/recipes/{id}/comments/{commentID}/delete", commentsController.DeleteComment).Methods("POST")
+	privateRouter.HandleFunc("/cook", cookController.WhatCanICook).Methods("GET")
+	privateRouter.HandleFunc("/cook/pantry", cookController.SavePantry).Methods("POST")
+	privateRouter.HandleFunc("/recipes/{id}/cooked", cookController.MarkCooked).Methods("POST")
+	privateRouter.HandleFunc("/pantry", pantryController.ListPantry).Methods("GET")
+	privateRouter.HandleFunc("/pantry", pantryController.CreatePantryItem).Methods("POST")
+	privateRouter.HandleFunc("/pantry/new", pantryController.NewPantryItem).Methods("GET")
+	privateRouter.HandleFunc("/pantry/{id}/edit", pantryController.EditPantryItem).Methods("GET")
+	privateRouter.HandleFunc("/pantry/{id}/edit", pantryController.UpdatePantryItem).Methods("POST")
+	privateRouter.HandleFunc("/pantry/{id}/delete", pantryController.DeletePantryItem).Methods("POST")
+	privateRouter.HandleFunc("/preferences", userController.UpdatePreferences).Methods("POST")
 	privateRouter.HandleFunc("/recipebooks/new", recipebookController.NewRecipeBook).Methods("GET")
 	privateRouter.HandleFunc("/recipebooks", recipebookController.CreateRecipeBook).Methods("POST")
 	privateRouter.HandleFunc("/recipebooks", recipebookController.ListRecipebooks).Methods("GET")
 	privateRouter.HandleFunc("/recipebooks/{id}", recipebookController.GetRecipeBook).Methods("GET")
+	privateRouter.HandleFunc("/recipebooks/{id}/export", exportController.ExportRecipeBook).Methods("GET")
 	privateRouter.HandleFunc("/recipebooks/{id}/share", recipebookController.CreateRecipeBookSharedLink).Methods("POST")
+	privateRouter.HandleFunc("/recipebooks/{id}/members", recipebookController.AddMember).Methods("POST")
+	privateRouter.HandleFunc("/recipebooks/{id}/members/{memberID}/remove", recipebookController.RemoveMember).Methods("POST")
+	privateRouter.HandleFunc("/recipebooks/{id}/gift", giftController.CreateGift).Methods("POST")
+	privateRouter.HandleFunc("/gifts/{token}", giftController.GetGift).Methods("GET")
+	privateRouter.HandleFunc("/gifts/{token}/accept", giftController.AcceptGift).Methods("POST")
+	privateRouter.HandleFunc("/gifts/{token}/decline", giftController.DeclineGift).Methods("POST")
+	privateRouter.HandleFunc("/recipebooks/{id}/recipes", recipebookController.AddRecipe).Methods("POST")
+	privateRouter.HandleFunc("/recipebooks/{id}/recipes/{recipeID}/remove", recipebookController.RemoveRecipe).Methods("POST")
+	privateRouter.HandleFunc("/recipebooks/{id}/recipes/{recipeID}/move", recipebookController.MoveRecipe).Methods("POST")
+	privateRouter.HandleFunc("/shoppinglists", shoppingController.ListShoppingLists).Methods("GET")
+	privateRouter.HandleFunc("/shoppinglists", shoppingController.CreateShoppingList).Methods("POST")
+	privateRouter.HandleFunc("/shoppinglists/new", shoppingController.NewShoppingList).Methods("GET")
+	privateRouter.HandleFunc("/shoppinglists/{id}", shoppingController.GetShoppingList).Methods("GET")
+	privateRouter.HandleFunc("/shoppinglists/{id}/export", shoppingController.ExportShoppingList).Methods("GET")
+	privateRouter.HandleFunc("/shoppinglists/{id}/delete", shoppingController.DeleteShoppingList).Methods("POST")
+	privateRouter.HandleFunc("/shoppinglists/{id}/items/{itemID}/toggle", shoppingController.ToggleShoppingListItem).Methods("POST")
+	privateRouter.HandleFunc("/mealplan", mealPlanController.GetWeek).Methods("GET")
+	privateRouter.HandleFunc("/mealplan", mealPlanController.AddMeal).Methods("POST")
+	privateRouter.HandleFunc("/mealplan/shoppinglist", mealPlanController.CreateShoppingList).Methods("POST")
+	privateRouter.HandleFunc("/mealplan/{id}/move", mealPlanController.MoveMeal).Methods("POST")
+	privateRouter.HandleFunc("/mealplan/{id}/delete", mealPlanController.RemoveMeal).Methods("POST")
 
 	fmt.Println("Server is running on port 8080")
 	log.Fatal(http.ListenAndServe(":8080", csrf.Protect([]byte(secret))(router)))
@@ -41,3 +41,9 @@ func RequireAuth(store sessions.Store) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// LoggedInUserID returns the ID of the user RequireAuth let through. It must
+// only be called from handlers behind RequireAuth.
+func LoggedInUserID(r *http.Request) uint {
+	return r.Context().Value(LoggedInUserCtxKey{}).(uint)
+}
@@ -0,0 +1,130 @@
+package models
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an empty in-memory database with the tables that hang off
+// the ingredient catalog.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would get a database of its own.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&Ingredient{}, &RecipeIngredient{}, &RecipeStep{}, &PantryItem{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestRenormalizeIngredientsRepointsEverything(t *testing.T) {
+	db := newTestDB(t)
+
+	// Saved before names were made singular: "egg" and "eggs" are two rows.
+	egg, eggs := Ingredient{Name: "egg"}, Ingredient{Name: "eggs"}
+	for _, ingredient := range []*Ingredient{&egg, &eggs} {
+		if err := db.Create(ingredient).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	line := RecipeIngredient{RecipeID: 1, IngredientID: eggs.ID, Name: "eggs"}
+	item := PantryItem{UserID: 1, IngredientID: eggs.ID, Name: "eggs", Quantity: 6}
+	onlyEggs := RecipeStep{RecipeID: 1, Text: "Beat the eggs.", Ingredients: []Ingredient{eggs}}
+	both := RecipeStep{RecipeID: 1, Text: "Add an egg, then the rest of the eggs.", Ingredients: []Ingredient{egg, eggs}}
+	for _, record := range []any{&line, &item, &onlyEggs, &both} {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := RenormalizeIngredients(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var remaining []Ingredient
+	if err := db.Find(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(remaining) != 1 || remaining[0].ID != egg.ID {
+		t.Fatalf("catalog = %+v, want only egg", remaining)
+	}
+	if err := db.First(&line, line.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if line.IngredientID != egg.ID {
+		t.Errorf("recipe line points at %d, want %d", line.IngredientID, egg.ID)
+	}
+	if err := db.First(&item, item.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if item.IngredientID != egg.ID {
+		t.Errorf("pantry item points at %d, want %d", item.IngredientID, egg.ID)
+	}
+	for _, step := range []RecipeStep{onlyEggs, both} {
+		var uses []Ingredient
+		if err := db.Model(&step).Association("Ingredients").Find(&uses); err != nil {
+			t.Fatal(err)
+		}
+		if len(uses) != 1 || uses[0].ID != egg.ID {
+			t.Errorf("step %q uses %+v, want only egg", step.Text, uses)
+		}
+	}
+}
+
+func TestMigratePantryListsMakesItems(t *testing.T) {
+	db := newTestDB(t)
+	// The users table as it was, with the saved list in a column.
+	err := db.Exec("CREATE TABLE `users` (`id` integer PRIMARY KEY, `email` text, `pantry` text)").Error
+	if err == nil {
+		err = db.Exec("INSERT INTO users (id, email, pantry) VALUES (1, 'a@example.com', ?), (2, 'b@example.com', '')",
+			"Eggs\n  flour, milk\n\neggs").Error
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	milk := Ingredient{Name: "milk"}
+	if err := db.Create(&milk).Error; err != nil {
+		t.Fatal(err)
+	}
+	item := PantryItem{UserID: 1, IngredientID: milk.ID, Name: "milk", Quantity: 1, Unit: "l"}
+	if err := db.Create(&item).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := MigratePantryLists(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var items []PantryItem
+	if err := db.Order("id").Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, item := range items {
+		if item.UserID != 1 {
+			t.Errorf("item %q belongs to user %d", item.Name, item.UserID)
+		}
+		names = append(names, item.Name)
+	}
+	if want := []string{"milk", "Eggs", "flour"}; !slices.Equal(names, want) {
+		t.Errorf("pantry = %q, want %q", names, want)
+	}
+	if items[0].Quantity != 1 {
+		t.Errorf("milk quantity = %v, want it left at 1", items[0].Quantity)
+	}
+	if db.Migrator().HasColumn(&User{}, "pantry") {
+		t.Error("users.pantry wasn't dropped")
+	}
+}
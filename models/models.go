@@ -1,43 +1,797 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/quantity"
+	"github.com/imsteev/recipebook/search"
+	"github.com/imsteev/recipebook/units"
+	"gorm.io/gorm"
+)
 
 type Recipe struct {
 	gorm.Model
-	UserID       uint         `json:"user_id"`
-	RecipeBookID uint         `json:"recipebook_id"` // optional
-	Name         string       `json:"name"`
-	Ingredients  []Ingredient `json:"ingredients" gorm:"many2many:recipe_ingredients;"`
-	Description  string       `json:"description"`
-	Instructions string       `json:"instructions"`
+	UserID      uint               `json:"user_id"`
+	Name        string             `json:"name"`
+	Ingredients []RecipeIngredient `json:"ingredients"`
+	Description string             `json:"description"`
+	Steps       []RecipeStep       `json:"steps"`
+	Servings    int                `json:"servings"`   // 0 when unknown
+	PrepTime    Minutes            `json:"prep_time"`  // 0 when unknown
+	CookTime    Minutes            `json:"cook_time"`  // 0 when unknown
+	SourceURL   string             `json:"source_url"` // the page it was imported from
+	Tags        []Tag              `json:"tags" gorm:"many2many:recipe_tags;"`
+	Photos      []RecipePhoto      `json:"photos"`
+	// ForkedFromID is the recipe this one was copied from, when someone
+	// saved it from a book shared with them.
+	ForkedFromID *uint `json:"forked_from_id,omitempty" gorm:"index"`
+	// ParentID is the recipe this one is a variant of, like the vegan
+	// version of a stew, and Variant what sets it apart. A variant only
+	// keeps what it changes (see Inherit).
+	ParentID *uint  `json:"parent_id,omitempty" gorm:"index"`
+	Variant  string `json:"variant,omitempty"`
+	// Overrides are the fields a variant sets for itself, by column name,
+	// like "description" or "ingredients". What isn't listed comes from its
+	// parent, and what is stays even if it's empty.
+	Overrides []string `json:"overrides,omitempty" gorm:"serializer:json"`
+	// SearchVector is maintained by the database (see search.Reindex), so
+	// gorm never reads or writes it.
+	SearchVector string `gorm:"type:tsvector;index:,type:gin;->:false;<-:false" json:"-"`
 }
 
-type Ingredient struct {
+// AfterSave keeps the recipe's search vector up to date. gorm runs it after
+// saving the recipe's ingredients, so they're indexed too.
+func (r *Recipe) AfterSave(tx *gorm.DB) error {
+	return search.Reindex(tx.Session(&gorm.Session{NewDB: true}), r.ID)
+}
+
+// FullName is the recipe's name, followed by what sets it apart if it's a
+// variant: "Stew: Vegan". A variant must have inherited its name.
+func (r Recipe) FullName() string {
+	if r.Variant == "" {
+		return r.Name
+	}
+	return r.Name + ": " + r.Variant
+}
+
+// TotalTime is how long the recipe takes from start to finish.
+func (r Recipe) TotalTime() Minutes {
+	return r.PrepTime + r.CookTime
+}
+
+// Copy returns a new, unsaved recipe with the same contents as r: its
+// fields, ingredient lines, steps and tags, which must be loaded. Its
+// photos, comments and history aren't copied, nor who it belongs to. A
+// variant must have inherited its parent's; the copy stands on its own.
+func (r Recipe) Copy() Recipe {
+	c := Recipe{
+		Name:        r.FullName(),
+		Description: r.Description,
+		Servings:    r.Servings,
+		PrepTime:    r.PrepTime,
+		CookTime:    r.CookTime,
+		SourceURL:   r.SourceURL,
+		Tags:        r.Tags,
+	}
+	for _, ri := range r.Ingredients {
+		ri.Model = gorm.Model{}
+		ri.RecipeID = 0
+		c.Ingredients = append(c.Ingredients, ri)
+	}
+	for _, step := range r.Steps {
+		step.Model = gorm.Model{}
+		step.RecipeID = 0
+		c.Steps = append(c.Steps, step)
+	}
+	return c
+}
+
+// Inherit fills in what variant r leaves to its parent recipe: every field
+// it doesn't override, ingredients, steps and tags included, and its photos
+// when it has none of its own. Both must have those loaded.
+func (r Recipe) Inherit(parent Recipe) Recipe {
+	if !r.Sets("name") {
+		r.Name = parent.Name
+	}
+	if !r.Sets("description") {
+		r.Description = parent.Description
+	}
+	if !r.Sets("servings") {
+		r.Servings = parent.Servings
+	}
+	if !r.Sets("prep_time") {
+		r.PrepTime = parent.PrepTime
+	}
+	if !r.Sets("cook_time") {
+		r.CookTime = parent.CookTime
+	}
+	if !r.Sets("source_url") {
+		r.SourceURL = parent.SourceURL
+	}
+	if !r.Sets("ingredients") {
+		r.Ingredients = parent.Ingredients
+	}
+	if !r.Sets("steps") {
+		r.Steps = parent.Steps
+	}
+	if !r.Sets("tags") {
+		r.Tags = parent.Tags
+	}
+	if len(r.Photos) == 0 {
+		r.Photos = parent.Photos
+	}
+	return r
+}
+
+// WithoutInherited undoes Inherit before variant r is saved: whatever it
+// has that's the same as its parent's is cleared, so it follows the parent
+// when that changes, and the rest is recorded in Overrides, so it's kept
+// even when it's empty. Ingredients, steps and tags are kept or cleared as a
+// whole.
+func (r Recipe) WithoutInherited(parent Recipe) Recipe {
+	r.Overrides = []string{}
+	differs := func(field string, same bool) bool {
+		if !same {
+			r.Overrides = append(r.Overrides, field)
+		}
+		return !same
+	}
+	if !differs("name", r.Name == parent.Name) {
+		r.Name = ""
+	}
+	if !differs("description", r.Description == parent.Description) {
+		r.Description = ""
+	}
+	if !differs("servings", r.Servings == parent.Servings) {
+		r.Servings = 0
+	}
+	if !differs("prep_time", r.PrepTime == parent.PrepTime) {
+		r.PrepTime = 0
+	}
+	if !differs("cook_time", r.CookTime == parent.CookTime) {
+		r.CookTime = 0
+	}
+	if !differs("source_url", r.SourceURL == parent.SourceURL) {
+		r.SourceURL = ""
+	}
+
+	mine, theirs := NewRevision(r, 0), NewRevision(parent, 0)
+	if !differs("ingredients", slices.Equal(mine.IngredientLines(), theirs.IngredientLines())) {
+		r.Ingredients = nil
+	}
+	if !differs("steps", slices.Equal(mine.StepLines(), theirs.StepLines())) {
+		r.Steps = nil
+	}
+	if !differs("tags", sameTags(r.Tags, parent.Tags)) {
+		r.Tags = nil
+	}
+	return r
+}
+
+// Sets reports whether variant r overrides field, named by its column,
+// rather than inheriting it. An original sets everything.
+func (r Recipe) Sets(field string) bool {
+	return r.ParentID == nil || slices.Contains(r.Overrides, field)
+}
+
+func sameTags(a, b []Tag) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	in := map[Tag]bool{}
+	for _, tag := range a {
+		in[Tag{Kind: tag.Kind, Name: tag.Name}] = true
+	}
+	for _, tag := range b {
+		if !in[Tag{Kind: tag.Kind, Name: tag.Name}] {
+			return false
+		}
+	}
+	return true
+}
+
+// Minutes is how long part of a recipe takes.
+type Minutes int
+
+// String renders m the way recipes write it: "45 min", "1 hr 30 min".
+func (m Minutes) String() string {
+	hours, minutes := int(m)/60, int(m)%60
+	switch {
+	case hours == 0:
+		return fmt.Sprintf("%d min", minutes)
+	case minutes == 0:
+		return fmt.Sprintf("%d hr", hours)
+	}
+	return fmt.Sprintf("%d hr %d min", hours, minutes)
+}
+
+// Cover is the photo shown for the recipe in lists, or nil if it has none.
+// Photos must be loaded in order.
+func (r Recipe) Cover() *RecipePhoto {
+	if len(r.Photos) == 0 {
+		return nil
+	}
+	return &r.Photos[0]
+}
+
+// RecipePhoto is a picture of a recipe. The image itself and its thumbnail
+// live in the photo store (see package storage) rather than the database.
+type RecipePhoto struct {
+	gorm.Model
+	RecipeID     uint   `json:"recipe_id" gorm:"index"`
+	Position     int    `json:"position"`
+	Key          string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	ContentType  string `json:"content_type"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// RecipeStep is one step of a recipe's method.
+type RecipeStep struct {
+	gorm.Model
+	RecipeID uint    `json:"-" gorm:"index"`
+	Position int     `json:"position"`
+	Text     string  `json:"text"`
+	Duration Minutes `json:"duration"` // how long to set a timer for, 0 for none
+	// Ingredients are the catalog rows of the recipe's ingredient lines the
+	// step uses. They're catalog rows rather than the lines themselves, which
+	// are replaced every time the recipe is saved.
+	Ingredients []Ingredient `json:"ingredients" gorm:"many2many:recipe_step_ingredients;"`
+}
+
+// StepIngredients returns the recipe's ingredient lines that step uses, in
+// the recipe's order. Ingredients must be loaded, with their catalog rows.
+func (r Recipe) StepIngredients(step RecipeStep) []RecipeIngredient {
+	uses := map[uint]bool{}
+	for _, ingredient := range step.Ingredients {
+		uses[ingredient.ID] = true
+	}
+	var out []RecipeIngredient
+	for _, ri := range r.Ingredients {
+		if uses[ri.IngredientID] {
+			out = append(out, ri)
+		}
+	}
+	return out
+}
+
+// numberedLine matches the start of a numbered step: "1.", "2)", "Step 3:".
+var numberedLine = regexp.MustCompile(`^\s*(?i:step\s*)?\d+\s*[.):](?:\s+|$)`)
+
+// SplitInstructions splits a method written as one block of text into
+// steps. Numbered lines start steps when there are any, with the lines
+// after each belonging to it; otherwise blank lines separate steps, or when
+// there are none of those either, each line is a step.
+func SplitInstructions(text string) []string {
+	text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+
+	numbered, blank := false, false
+	for _, line := range lines {
+		numbered = numbered || numberedLine.MatchString(line)
+		blank = blank || strings.TrimSpace(line) == ""
+	}
+
+	var steps, current []string
+	flush := func() {
+		if len(current) > 0 {
+			steps = append(steps, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		switch {
+		case numbered && numberedLine.MatchString(line):
+			flush()
+			line = numberedLine.ReplaceAllString(line, "")
+		case line == "":
+			if !numbered {
+				flush()
+			}
+			continue
+		case !numbered && !blank:
+			flush()
+		}
+		if line != "" {
+			current = append(current, line)
+		}
+	}
+	flush()
+	return steps
+}
+
+// MigrateInstructions moves the methods of recipes saved before steps
+// existed, kept as one block of text in recipes.instructions, into their
+// steps (see SplitInstructions), then drops the column.
+func MigrateInstructions(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Recipe{}, "instructions") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var recipes []struct {
+			ID           uint
+			Instructions string
+		}
+		err := tx.Table("recipes").
+			Select("id, instructions").
+			Where("instructions IS NOT NULL AND instructions <> ''").
+			Find(&recipes).Error
+		if err != nil {
+			return err
+		}
+		for _, recipe := range recipes {
+			var steps []RecipeStep
+			for i, text := range SplitInstructions(recipe.Instructions) {
+				steps = append(steps, RecipeStep{RecipeID: recipe.ID, Position: i, Text: text})
+			}
+			if len(steps) == 0 {
+				continue
+			}
+			if err := tx.Create(&steps).Error; err != nil {
+				return fmt.Errorf("failed to save the steps of recipe %d: %w", recipe.ID, err)
+			}
+		}
+		return tx.Migrator().DropColumn(&Recipe{}, "instructions")
+	})
+}
+
+// MigrateVariantOverrides records what each variant saved before Overrides
+// existed sets for itself: back then a variant inherited whatever it left
+// empty, so everything it has is an override. It has to run after
+// MigrateInstructions, since steps count, and reindexes the variants it
+// changes for search.
+func MigrateVariantOverrides(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var variants []Recipe
+		err := tx.Preload("Ingredients").Preload("Steps").Preload("Tags").
+			Where("parent_id IS NOT NULL AND overrides IS NULL").
+			Find(&variants).Error
+		if err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			overrides := []string{}
+			for field, set := range map[string]bool{
+				"name":        variant.Name != "",
+				"description": variant.Description != "",
+				"servings":    variant.Servings != 0,
+				"prep_time":   variant.PrepTime != 0,
+				"cook_time":   variant.CookTime != 0,
+				"source_url":  variant.SourceURL != "",
+				"ingredients": len(variant.Ingredients) > 0,
+				"steps":       len(variant.Steps) > 0,
+				"tags":        len(variant.Tags) > 0,
+			} {
+				if set {
+					overrides = append(overrides, field)
+				}
+			}
+			slices.Sort(overrides)
+			err := tx.Model(&variant).Select("overrides").UpdateColumns(Recipe{Overrides: overrides}).Error
+			if err != nil {
+				return fmt.Errorf("failed to save the overrides of variant %d: %w", variant.ID, err)
+			}
+			if err := search.Reindex(tx, variant.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MigratePantryLists turns the lists of ingredients on hand users saved from
+// "What can I cook?", before there were pantry items, into pantry items
+// without a quantity, then drops the column. Ingredients already in the
+// user's pantry aren't added again.
+func MigratePantryLists(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&User{}, "pantry") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var users []struct {
+			ID     uint
+			Pantry string
+		}
+		err := tx.Table("users").
+			Select("id, pantry").
+			Where("pantry IS NOT NULL AND pantry <> ''").
+			Find(&users).Error
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			var have []uint
+			if err := tx.Model(&PantryItem{}).Where("user_id = ?", user.ID).Pluck("ingredient_id", &have).Error; err != nil {
+				return err
+			}
+			names := strings.FieldsFunc(user.Pantry, func(r rune) bool { return r == '\n' || r == ',' })
+			for _, name := range names {
+				if name = strings.TrimSpace(name); name == "" {
+					continue
+				}
+				var ingredient Ingredient
+				if err := tx.Where(Ingredient{Name: catalog.Name(name)}).FirstOrCreate(&ingredient).Error; err != nil {
+					return err
+				}
+				if slices.Contains(have, ingredient.ID) {
+					continue
+				}
+				item := PantryItem{UserID: user.ID, IngredientID: ingredient.ID, Name: name}
+				if err := tx.Create(&item).Error; err != nil {
+					return fmt.Errorf("failed to save the pantry of user %d: %w", user.ID, err)
+				}
+				have = append(have, ingredient.ID)
+			}
+		}
+		return tx.Migrator().DropColumn(&User{}, "pantry")
+	})
+}
+
+// MigrateIngredientQuantities moves the quantities of recipes saved before
+// they were parsed, when every recipe had ingredient rows of its own with
+// the amount typed into ingredients.quantity, onto the recipes' ingredient
+// lines, then drops the column. Those lines are the ones without a name of
+// their own. It has to run before RenormalizeIngredients merges the rows it
+// reads from.
+func MigrateIngredientQuantities(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Ingredient{}, "quantity") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		var lines []struct {
+			RecipeID     uint
+			IngredientID uint
+			Name         string
+			Quantity     string
+		}
+		err := tx.Table("recipe_ingredients").
+			Select("recipe_ingredients.recipe_id, recipe_ingredients.ingredient_id, ingredients.name, ingredients.quantity").
+			Joins("JOIN ingredients ON ingredients.id = recipe_ingredients.ingredient_id").
+			Where("recipe_ingredients.name IS NULL OR recipe_ingredients.name = ''").
+			Order("recipe_ingredients.recipe_id, recipe_ingredients.ingredient_id").
+			Find(&lines).Error
+		if err != nil {
+			return err
+		}
+		positions := map[uint]int{}
+		for _, line := range lines {
+			amount := quantity.Parse(line.Quantity)
+			err := tx.Table("recipe_ingredients").
+				Where("recipe_id = ? AND ingredient_id = ?", line.RecipeID, line.IngredientID).
+				Updates(map[string]any{
+					"position":      positions[line.RecipeID],
+					"name":          line.Name,
+					"quantity_text": amount.Text,
+					"quantity":      amount.Value,
+					"quantity_max":  amount.Max,
+					"unit":          amount.Unit,
+				}).Error
+			if err != nil {
+				return fmt.Errorf("failed to save the quantities of recipe %d: %w", line.RecipeID, err)
+			}
+			positions[line.RecipeID]++
+		}
+		return tx.Migrator().DropColumn(&Ingredient{}, "quantity")
+	})
+}
+
+// RecipeRevision is a snapshot of a recipe as it was saved. One is taken
+// every time a recipe is created, edited or restored, so earlier versions
+// can be compared with later ones and brought back. Ingredients, steps and
+// tags are kept as they were typed, since the rows they came from are
+// replaced on every save.
+type RecipeRevision struct {
 	gorm.Model
+	RecipeID     uint `gorm:"uniqueIndex:idx_recipe_revisions_number"`
+	Number       int  `gorm:"uniqueIndex:idx_recipe_revisions_number"` // counting from 1 for each recipe
+	AuthorID     uint
+	Author       User
+	RestoredFrom int // the Number of the revision this one brought back, or 0
+	Name         string
+	Description  string
+	Servings     int
+	PrepTime     Minutes
+	CookTime     Minutes
+	SourceURL    string
+	Ingredients  []RevisionIngredient `gorm:"serializer:json"`
+	Steps        []RevisionStep       `gorm:"serializer:json"`
+	Tags         []RevisionTag        `gorm:"serializer:json"`
+}
+
+type RevisionIngredient struct {
 	Name     string `json:"name"`
-	Quantity string `json:"quantity"` // TODO: should this be well-defined or string okay?
+	Quantity string `json:"quantity"`
+}
+
+type RevisionStep struct {
+	Text        string   `json:"text"`
+	Duration    Minutes  `json:"duration"`
+	Ingredients []string `json:"ingredients"` // the names of the lines it uses
+}
+
+type RevisionTag struct {
+	Kind TagKind `json:"kind"`
+	Name string  `json:"name"`
+}
+
+// NewRevision snapshots recipe for authorID. Its ingredients, steps and
+// tags must be loaded. Number is left for the caller to fill in.
+func NewRevision(recipe Recipe, authorID uint) RecipeRevision {
+	revision := RecipeRevision{
+		RecipeID:    recipe.ID,
+		AuthorID:    authorID,
+		Name:        recipe.Name,
+		Description: recipe.Description,
+		Servings:    recipe.Servings,
+		PrepTime:    recipe.PrepTime,
+		CookTime:    recipe.CookTime,
+		SourceURL:   recipe.SourceURL,
+	}
+	for _, ri := range recipe.Ingredients {
+		revision.Ingredients = append(revision.Ingredients, RevisionIngredient{Name: ri.DisplayName(), Quantity: ri.QuantityText})
+	}
+	for _, step := range recipe.Steps {
+		s := RevisionStep{Text: step.Text, Duration: step.Duration}
+		for _, ri := range recipe.StepIngredients(step) {
+			s.Ingredients = append(s.Ingredients, ri.DisplayName())
+		}
+		revision.Steps = append(revision.Steps, s)
+	}
+	for _, tag := range recipe.Tags {
+		revision.Tags = append(revision.Tags, RevisionTag{Kind: tag.Kind, Name: tag.Name})
+	}
+	return revision
+}
+
+// IngredientLines are the revision's ingredients one per line, the way
+// they read: "2 cups flour".
+func (r RecipeRevision) IngredientLines() []string {
+	lines := make([]string, len(r.Ingredients))
+	for i, ingredient := range r.Ingredients {
+		lines[i] = strings.TrimSpace(ingredient.Quantity + " " + ingredient.Name)
+	}
+	return lines
+}
+
+// StepLines are the revision's steps one per entry, with their timers and
+// the ingredients they use noted after them.
+func (r RecipeRevision) StepLines() []string {
+	lines := make([]string, len(r.Steps))
+	for i, step := range r.Steps {
+		lines[i] = step.Text
+		if step.Duration > 0 {
+			lines[i] += fmt.Sprintf(" (%s timer)", step.Duration)
+		}
+		if len(step.Ingredients) > 0 {
+			lines[i] += " [uses " + strings.Join(step.Ingredients, ", ") + "]"
+		}
+	}
+	return lines
+}
+
+// TagKind groups tags in the recipe form and in filters.
+type TagKind string
+
+const (
+	TagCuisine TagKind = "cuisine" // italian, thai
+	TagCourse  TagKind = "course"  // breakfast, dessert
+	TagDiet    TagKind = "diet"    // vegan, gluten-free
+	TagOther   TagKind = "other"
+)
+
+var TagKinds = []TagKind{TagCuisine, TagCourse, TagDiet, TagOther}
+
+// Label is the kind's name in the recipe form.
+func (k TagKind) Label() string {
+	switch k {
+	case TagCuisine:
+		return "Cuisine"
+	case TagCourse:
+		return "Course"
+	case TagDiet:
+		return "Dietary"
+	}
+	return "Other"
+}
+
+// Tag labels recipes. Tags are shared between users like ingredients are,
+// so filtering by "vegan" finds recipes from every book you can see.
+type Tag struct {
+	gorm.Model
+	Kind TagKind `json:"kind" gorm:"uniqueIndex:idx_tags_kind_name"`
+	Name string  `json:"name" gorm:"uniqueIndex:idx_tags_kind_name"` // always NormalizeTagName'd
+}
+
+// NormalizeTagName returns the stored form of a tag name.
+func NormalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// Ingredient is a shared catalog entry. Recipes don't own their ingredients;
+// they point at these through RecipeIngredient so that "Flour" in one recipe
+// and "flour" in another are the same row.
+type Ingredient struct {
+	gorm.Model
+	Name string `json:"name" gorm:"index"` // always in its catalog.Name form
+}
+
+// RenormalizeIngredients brings catalog rows saved under an older
+// catalog.Name up to date, merging rows that now have the same name into the
+// oldest one. Recipe lines, the steps that use them and pantry items follow
+// the rows they pointed at.
+func RenormalizeIngredients(db *gorm.DB) error {
+	var ingredients []Ingredient
+	if err := db.Order("id ASC").Find(&ingredients).Error; err != nil {
+		return err
+	}
+
+	keep := map[string]uint{}
+	for _, ingredient := range ingredients {
+		name := catalog.Name(ingredient.Name)
+		if _, ok := keep[name]; !ok {
+			keep[name] = ingredient.ID
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, ingredient := range ingredients {
+			name := catalog.Name(ingredient.Name)
+			if id := keep[name]; id != ingredient.ID {
+				err := tx.Model(&RecipeIngredient{}).Where("ingredient_id = ?", ingredient.ID).Update("ingredient_id", id).Error
+				if err != nil {
+					return err
+				}
+				err = tx.Model(&PantryItem{}).Where("ingredient_id = ?", ingredient.ID).Update("ingredient_id", id).Error
+				if err != nil {
+					return err
+				}
+				// A step can only use an ingredient once, so where it used
+				// both rows it keeps the one it already has.
+				err = tx.Exec(`DELETE FROM recipe_step_ingredients WHERE ingredient_id = ? AND recipe_step_id IN (
+					SELECT recipe_step_id FROM recipe_step_ingredients WHERE ingredient_id = ?
+				)`, ingredient.ID, id).Error
+				if err != nil {
+					return err
+				}
+				err = tx.Exec("UPDATE recipe_step_ingredients SET ingredient_id = ? WHERE ingredient_id = ?", id, ingredient.ID).Error
+				if err != nil {
+					return err
+				}
+				if err := tx.Delete(&ingredient).Error; err != nil {
+					return err
+				}
+			} else if name != ingredient.Name {
+				if err := tx.Model(&ingredient).Update("name", name).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
 }
 
+// RecipeIngredient is one line of a recipe's ingredient list.
 type RecipeIngredient struct {
 	gorm.Model
-	RecipeID     uint
-	IngredientID uint
-	Quantity     float64 `json:"quantity"`
-	Unit         string  `json:"unit"`
+	RecipeID     uint       `json:"-"`
+	IngredientID uint       `json:"-"`
+	Ingredient   Ingredient `json:"-"`
+	Position     int        `json:"position"`
+	Name         string     `json:"name"`          // as typed, for display
+	QuantityText string     `json:"quantity_text"` // as typed, for display
+	Quantity     float64    `json:"quantity"`
+	QuantityMax  float64    `json:"quantity_max"` // upper bound of a range like "2-3", otherwise 0
+	Unit         string     `json:"unit"`
+}
+
+// DisplayName is the name as the author typed it, falling back to the
+// catalog name for rows saved before we kept the original text.
+func (ri RecipeIngredient) DisplayName() string {
+	if ri.Name != "" {
+		return ri.Name
+	}
+	return ri.Ingredient.Name
+}
+
+// Amount returns the parsed quantity of this line.
+func (ri RecipeIngredient) Amount() quantity.Amount {
+	return quantity.Amount{Value: ri.Quantity, Max: ri.QuantityMax, Unit: ri.Unit, Text: ri.QuantityText}
 }
 
 type User struct {
 	gorm.Model
 	Username string `json:"username"`
 	Password string `json:"-"` // "-" tag prevents password from being serialized to JSON
+
+	// Display preferences for recipe pages.
+	UnitSystem       units.System `json:"unit_system"`       // empty means "as written"
+	WeighIngredients bool         `json:"weigh_ingredients"` // show flour, sugar, etc. by weight
 }
 
 // RecipeBooks is a collection of recipes.
-// One requirement to consider: ability to gift RecipeBooks to other users. Would need to think about ownership.
+// CreatedBy is the book's current owner; it changes hands when the book is
+// gifted (see RecipeBookGift).
 type RecipeBook struct {
 	gorm.Model
 	CreatedBy uint
 	Name      string
+	Recipes   []RecipeBookRecipe
+	Members   []RecipeBookMember
+}
+
+type Role string
+
+const (
+	RoleOwner  Role = "owner"  // can do anything, including managing members and sharing
+	RoleEditor Role = "editor" // can add, reorder and edit the book's recipes
+	RoleViewer Role = "viewer" // can only read
+)
+
+// RecipeBookMember gives a user access to someone else's recipe book. The
+// book's creator is always an owner and doesn't need a row here.
+type RecipeBookMember struct {
+	gorm.Model
+	RecipeBookID uint `gorm:"index"`
+	UserID       uint `gorm:"index"`
+	User         User
+	Role         Role
+}
+
+// RecipeBookRecipe places a recipe in a recipe book. A recipe can be in any
+// number of books, and each book keeps its own order.
+type RecipeBookRecipe struct {
+	gorm.Model
+	RecipeBookID uint `gorm:"index"`
+	RecipeID     uint `gorm:"index"`
+	Recipe       Recipe
+	Position     int
+}
+
+type GiftStatus string
+
+const (
+	GiftPending   GiftStatus = "pending"
+	GiftAccepted  GiftStatus = "accepted"
+	GiftDeclined  GiftStatus = "declined"
+	GiftCancelled GiftStatus = "cancelled" // the giver sent a new gift instead
+)
+
+// RecipeBookGift offers ownership of a recipe book, with a message. It's
+// addressed either to a known user or, when ToUserID is nil, to whoever
+// opens the claim link first.
+type RecipeBookGift struct {
+	gorm.Model
+	RecipeBookID  uint `gorm:"index"`
+	RecipeBook    RecipeBook
+	FromUserID    uint
+	FromUser      User
+	ToUserID      *uint  `gorm:"index"`
+	ClaimToken    string `gorm:"uniqueIndex"`
+	Message       string
+	Status        GiftStatus
+	RespondedAt   *time.Time
+	MessageSeenAt *time.Time // when the recipient first opened the book after accepting
+}
+
+// RecipeBookTransfer is the audit trail of a book changing owners.
+type RecipeBookTransfer struct {
+	gorm.Model
+	RecipeBookID uint `gorm:"index"`
+	FromUserID   uint
+	FromUser     User
+	ToUserID     uint
+	ToUser       User
+	GiftID       uint
 }
 
 type RecipeBookSharedLink struct {
@@ -46,12 +800,91 @@ type RecipeBookSharedLink struct {
 	Slug         string `gorm:"unique"`
 }
 
-// RecipeMessage models messages associated with a RecipeBook.
-// Intention is to support a gift message, but could also be used for other
-// commentary on a Recipe.
+// ShoppingList is a saved, consolidated list of ingredients for one or more
+// recipes.
+type ShoppingList struct {
+	gorm.Model
+	UserID uint
+	Name   string
+	Items  []ShoppingListItem
+}
+
+type ShoppingListItem struct {
+	gorm.Model
+	ShoppingListID uint
+	Position       int
+	Category       string
+	Name           string
+	Quantity       string // already merged and formatted, e.g. "2 cups + 1 pinch"
+	Checked        bool
+}
+
+// MealSlots are the meals of the day a recipe can be planned for.
+var MealSlots = []string{"breakfast", "lunch", "dinner"}
+
+// MealPlan schedules one of a user's recipes for a meal on a given day.
+type MealPlan struct {
+	gorm.Model
+	UserID   uint      `gorm:"index"`
+	Date     time.Time `gorm:"type:date;index"`
+	Slot     string    // one of MealSlots
+	RecipeID uint
+	Recipe   Recipe
+}
+
+// PantryItem is something a user has in their kitchen. Quantity is 0 when
+// they didn't say how much, in which case cooking never uses it up.
+type PantryItem struct {
+	gorm.Model
+	UserID       uint `gorm:"index"`
+	IngredientID uint
+	Ingredient   Ingredient
+	Name         string // as typed, for display
+	Quantity     float64
+	Unit         string
+	ExpiresOn    *time.Time `gorm:"type:date"`
+}
+
+// Amount returns how much of the item is left.
+func (p PantryItem) Amount() quantity.Amount {
+	a := quantity.Amount{Value: p.Quantity, Unit: p.Unit}
+	a.Text = a.String()
+	return a
+}
+
+// ExpiresWithin reports whether the item expires in the next days days (or
+// already has), counting from today.
+func (p PantryItem) ExpiresWithin(days int) bool {
+	if p.ExpiresOn == nil {
+		return false
+	}
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return !p.ExpiresOn.After(today.AddDate(0, 0, days))
+}
+
+// Expired reports whether the item's expiry date has passed.
+func (p PantryItem) Expired() bool {
+	return p.ExpiresWithin(-1)
+}
+
+// CookedRecipe records a user cooking a recipe.
+type CookedRecipe struct {
+	gorm.Model
+	UserID   uint `gorm:"index"`
+	RecipeID uint `gorm:"index"`
+	Servings int  // as cooked, 0 when the recipe doesn't say
+}
+
+// RecipeMessage is a comment on a Recipe. Comments are threaded: a reply
+// points at the comment it answers with ParentID. Guests reading a shared
+// recipe book can comment too, so UserID is nil for them and From is the
+// name they gave.
 type RecipeMessage struct {
 	gorm.Model
+	RecipeID uint  `gorm:"index"` // required
+	ParentID *uint `gorm:"index"`
+	UserID   *uint
 	From     string // required
-	RecipeID uint   //required
 	Message  string // required
 }
@@ -0,0 +1,58 @@
+package models
+
+import "testing"
+
+func TestVariantCanClearWhatItsParentSets(t *testing.T) {
+	parentID := uint(1)
+	parent := Recipe{
+		Name:        "Stew",
+		Description: "A hearty stew.",
+		Servings:    4,
+		Ingredients: []RecipeIngredient{{Name: "beef", QuantityText: "1 kg"}},
+		Tags:        []Tag{{Kind: "diet", Name: "meaty"}},
+	}
+
+	// The variant as edited: renamed in its variant name only, with the
+	// description and tags taken out and the ingredients left alone.
+	edited := Recipe{ParentID: &parentID, Variant: "Vegan"}.Inherit(parent)
+	edited.Description = ""
+	edited.Tags = nil
+
+	saved := edited.WithoutInherited(parent)
+	if saved.Description != "" || saved.Ingredients != nil || saved.Name != "" {
+		t.Errorf("WithoutInherited kept what it should inherit: %+v", saved)
+	}
+	want := []string{"description", "tags"}
+	if len(saved.Overrides) != len(want) || saved.Overrides[0] != want[0] || saved.Overrides[1] != want[1] {
+		t.Errorf("Overrides = %q, want %q", saved.Overrides, want)
+	}
+
+	read := saved.Inherit(parent)
+	if read.Description != "" {
+		t.Errorf("Description = %q, want it to stay cleared", read.Description)
+	}
+	if len(read.Tags) != 0 {
+		t.Errorf("Tags = %v, want them to stay cleared", read.Tags)
+	}
+	if read.Name != "Stew" || read.Servings != 4 || len(read.Ingredients) != 1 {
+		t.Errorf("didn't inherit the rest: %+v", read)
+	}
+}
+
+func TestVariantFollowsItsParent(t *testing.T) {
+	parentID := uint(1)
+	parent := Recipe{Name: "Stew", Servings: 4}
+	saved := Recipe{ParentID: &parentID, Variant: "Big batch"}.Inherit(parent)
+	saved.Servings = 8
+	saved = saved.WithoutInherited(parent)
+
+	parent.Name = "Beef stew"
+	parent.Servings = 6
+	read := saved.Inherit(parent)
+	if read.Name != "Beef stew" {
+		t.Errorf("Name = %q, want the parent's new name", read.Name)
+	}
+	if read.Servings != 8 {
+		t.Errorf("Servings = %d, want the variant's own 8", read.Servings)
+	}
+}
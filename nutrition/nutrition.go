@@ -0,0 +1,279 @@
+// Package nutrition estimates the calories and macronutrients in a recipe
+// from a table of common ingredients bundled with the app. Ingredients are
+// matched by name and weighed, so the estimate is only as good as the
+// amounts the recipe gives; whatever can't be matched or weighed is left out
+// and listed, rather than guessed.
+package nutrition
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/quantity"
+	"github.com/imsteev/recipebook/units"
+)
+
+//go:embed foods.csv
+var bundled []byte
+
+// Facts are the nutrients in some amount of food: calories in kcal, the rest
+// in grams.
+type Facts struct {
+	Calories float64
+	Protein  float64
+	Fat      float64
+	Carbs    float64
+}
+
+// Plus is f and g together.
+func (f Facts) Plus(g Facts) Facts {
+	return Facts{f.Calories + g.Calories, f.Protein + g.Protein, f.Fat + g.Fat, f.Carbs + g.Carbs}
+}
+
+// Times is f multiplied by factor.
+func (f Facts) Times(factor float64) Facts {
+	return Facts{f.Calories * factor, f.Protein * factor, f.Fat * factor, f.Carbs * factor}
+}
+
+// Food is one row of the nutrient table.
+type Food struct {
+	Name       string
+	Per100g    Facts
+	GramsPerML float64 // 0 when it isn't measured by volume
+	EachUnit   string  // what it's counted in, empty for whole items
+	EachGrams  float64 // what one of EachUnit weighs, 0 when it isn't counted
+}
+
+// Table is the nutrient table, keyed by normalized ingredient name.
+type Table struct {
+	foods map[string]Food
+}
+
+// Bundled loads the nutrient table that ships with the app.
+func Bundled() (*Table, error) {
+	return Load(bytes.NewReader(bundled))
+}
+
+// Load reads a nutrient table in the CSV layout of foods.csv: a header row,
+// then one food per row with its nutrients per 100 g. Lines starting with #
+// are comments.
+func Load(r io.Reader) (*Table, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read nutrient table header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range []string{"name", "calories", "protein", "fat", "carbs", "grams_per_ml", "each_unit", "each_grams"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("nutrient table has no %q column", name)
+		}
+	}
+
+	t := &Table{foods: map[string]Food{}}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read nutrient table: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		var numbers [6]float64
+		for i, name := range []string{"calories", "protein", "fat", "carbs", "grams_per_ml", "each_grams"} {
+			field := strings.TrimSpace(record[columns[name]])
+			if field == "" {
+				continue
+			}
+			numbers[i], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("nutrient table line %d: %s must be a number", line, name)
+			}
+		}
+		food := Food{
+			Name:       strings.TrimSpace(record[columns["name"]]),
+			Per100g:    Facts{numbers[0], numbers[1], numbers[2], numbers[3]},
+			GramsPerML: numbers[4],
+			EachUnit:   strings.TrimSpace(record[columns["each_unit"]]),
+			EachGrams:  numbers[5],
+		}
+		if food.Name == "" {
+			return nil, fmt.Errorf("nutrient table line %d has no name", line)
+		}
+		t.foods[catalog.Name(food.Name)] = food
+	}
+	return t, nil
+}
+
+// Lookup finds the food an ingredient is. Like the shopping list's aisles,
+// it tries the full name first, then its last two words and its last word,
+// so "extra virgin olive oil" is olive oil and "red onion" is onion.
+func (t *Table) Lookup(ingredient string) (Food, bool) {
+	name := catalog.Name(ingredient)
+	if food, ok := t.foods[name]; ok {
+		return food, true
+	}
+	words := strings.Fields(name)
+	if len(words) >= 2 {
+		if food, ok := t.foods[strings.Join(words[len(words)-2:], " ")]; ok {
+			return food, true
+		}
+	}
+	if len(words) >= 1 {
+		if food, ok := t.foods[words[len(words)-1]]; ok {
+			return food, true
+		}
+	}
+	return Food{}, false
+}
+
+// pinches are the counted units that are really tiny volumes, in
+// millilitres.
+var pinches = map[string]float64{
+	"pinch": 0.31, // 1/16 tsp
+	"dash":  0.62, // 1/8 tsp
+}
+
+// sizes are words people count whole items in: "1 large" egg.
+var sizes = map[string]bool{
+	"small": true, "medium": true, "large": true, "whole": true,
+}
+
+// Grams weighs an amount of the food. Ranges like "2-3" are taken at their
+// middle.
+func (f Food) Grams(a quantity.Amount) (float64, error) {
+	if a.Value == 0 {
+		return 0, errors.New("no amount given")
+	}
+	v := a.Value
+	if a.IsRange() {
+		v = (a.Value + a.Max) / 2
+	}
+
+	unit, known := units.Lookup(a.Unit)
+	if ml, ok := pinches[a.Unit]; ok {
+		unit, known = units.Lookup("ml")
+		v *= ml
+	}
+	switch {
+	case known && unit.Dimension == units.Mass:
+		return v * unit.Base, nil
+	case known && unit.Dimension == units.Volume:
+		density := f.GramsPerML
+		if density == 0 {
+			density, _ = units.Density(f.Name)
+		}
+		if density == 0 {
+			return 0, fmt.Errorf("can't weigh a %s of it", a.Unit)
+		}
+		return v * unit.Base * density, nil
+	}
+
+	// Counted: by the food's own unit ("2 cloves" of garlic), or as whole
+	// items ("3" eggs).
+	counted := catalog.Name(a.Unit)
+	if f.EachGrams > 0 && (counted == f.EachUnit || f.EachUnit == "" && sizes[a.Unit]) {
+		return v * f.EachGrams, nil
+	}
+	if a.Unit == "" {
+		return 0, errors.New("can't weigh a whole one")
+	}
+	return 0, fmt.Errorf("can't weigh a %s of it", counted)
+}
+
+// Line is what one of a recipe's ingredients adds to the estimate.
+type Line struct {
+	Ingredient string // as the recipe names it
+	Food       string // what it was matched to, empty if nothing
+	Grams      float64
+	Facts      Facts
+	Problem    string // why it was left out, empty if it wasn't
+}
+
+// Counted reports whether the line is part of the estimate.
+func (l Line) Counted() bool {
+	return l.Problem == ""
+}
+
+// Estimate is the nutrition of a whole recipe.
+type Estimate struct {
+	Total    Facts
+	Servings int // 0 when the recipe doesn't say
+	Lines    []Line
+}
+
+// Estimate adds up the nutrients in a recipe as written. Recipes must have
+// their Ingredients (and Ingredients.Ingredient) loaded.
+func (t *Table) Estimate(recipe models.Recipe) Estimate {
+	e := Estimate{Servings: recipe.Servings}
+	for _, ri := range recipe.Ingredients {
+		line := Line{Ingredient: ri.DisplayName()}
+		name := ri.Ingredient.Name
+		if name == "" {
+			name = ri.DisplayName()
+		}
+		food, ok := t.Lookup(name)
+		if !ok {
+			line.Problem = "not in the nutrient table"
+			e.Lines = append(e.Lines, line)
+			continue
+		}
+		line.Food = food.Name
+		grams, err := food.Grams(ri.Amount())
+		// Salt "to taste" adds nothing however much it is.
+		if err != nil && food.Per100g != (Facts{}) {
+			line.Problem = err.Error()
+			e.Lines = append(e.Lines, line)
+			continue
+		}
+		line.Grams = grams
+		line.Facts = food.Per100g.Times(grams / 100)
+		e.Total = e.Total.Plus(line.Facts)
+		e.Lines = append(e.Lines, line)
+	}
+	return e
+}
+
+// PerServing is the total divided between the servings, or the total when
+// the recipe doesn't say how many it serves.
+func (e Estimate) PerServing() Facts {
+	if e.Servings <= 0 {
+		return e.Total
+	}
+	return e.Total.Times(1 / float64(e.Servings))
+}
+
+// Counted reports whether any ingredient made it into the estimate.
+func (e Estimate) Counted() bool {
+	for _, line := range e.Lines {
+		if line.Counted() {
+			return true
+		}
+	}
+	return false
+}
+
+// Missing are the lines left out of the estimate.
+func (e Estimate) Missing() []Line {
+	var missing []Line
+	for _, line := range e.Lines {
+		if !line.Counted() {
+			missing = append(missing, line)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,115 @@
+package pantry
+
+import (
+	"sort"
+
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/quantity"
+	"github.com/imsteev/recipebook/units"
+)
+
+// Use is how much of one pantry item cooking a recipe takes.
+type Use struct {
+	Item   models.PantryItem // with Quantity already reduced
+	Used   float64           // in the item's unit
+	UsedUp bool              // nothing is left, so the item should go
+	For    string            // the recipe's ingredient line it went into
+}
+
+// Amount is how much of the item was used.
+func (u Use) Amount() quantity.Amount {
+	a := quantity.Amount{Value: u.Used, Unit: u.Item.Unit}
+	a.Text = a.String()
+	return a
+}
+
+// Deduct works out what cooking recipe, scaled by scale, takes out of items.
+// Each ingredient is taken from matching items that expire soonest first.
+// Items with no quantity are never used up, and ingredients whose amount
+// can't be converted into an item's unit ("a pinch" against "500 g") are
+// skipped. Recipes must have their Ingredients (and Ingredients.Ingredient)
+// loaded, and items their Ingredient.
+func Deduct(items []models.PantryItem, recipe models.Recipe, scale float64) []Use {
+	items = append([]models.PantryItem(nil), items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		ei, ej := items[i].ExpiresOn, items[j].ExpiresOn
+		if ei == nil || ej == nil {
+			return ej == nil && ei != nil
+		}
+		return ei.Before(*ej)
+	})
+
+	used := map[uint]int{} // item ID to its index in uses
+	var uses []Use
+	for _, ri := range recipe.Ingredients {
+		need := ri.Quantity * scale
+		if need <= 0 {
+			continue
+		}
+		key := ri.Ingredient.Name
+		if key == "" {
+			key = catalog.Name(ri.DisplayName())
+		}
+
+		for i := range items {
+			item := &items[i]
+			if need <= 0 {
+				break
+			}
+			if item.Quantity <= 0 || !covers([]string{itemKey(*item)}, key) {
+				continue
+			}
+			amount, ok := convert(need, ri.Unit, item.Unit, key)
+			if !ok {
+				continue
+			}
+
+			take := amount
+			if take > item.Quantity {
+				take = item.Quantity
+			}
+			item.Quantity -= take
+			need -= need * take / amount
+
+			if j, ok := used[item.ID]; ok {
+				uses[j].Used += take
+				uses[j].Item = *item
+				uses[j].UsedUp = item.Quantity <= epsilon
+			} else {
+				used[item.ID] = len(uses)
+				uses = append(uses, Use{Item: *item, Used: take, UsedUp: item.Quantity <= epsilon, For: ri.DisplayName()})
+			}
+		}
+	}
+	return uses
+}
+
+// epsilon absorbs floating-point rounding, so that using "1/3 cup" three
+// times from "1 cup" leaves nothing rather than a trace. It's far too small
+// to hide a real difference: "1 cup" used from "240 ml" leaves about 3 ml.
+const epsilon = 1e-6
+
+func itemKey(item models.PantryItem) string {
+	if item.Ingredient.Name != "" {
+		return item.Ingredient.Name
+	}
+	return catalog.Name(item.Name)
+}
+
+// convert expresses v (in from) in the unit to, weighing volumes of
+// ingredients we know the density of when to is a mass.
+func convert(v float64, from, to, ingredient string) (float64, bool) {
+	if from == to {
+		return v, true
+	}
+	if converted, err := units.Convert(v, from, to); err == nil {
+		return converted, true
+	}
+	if grams, ok := units.VolumeToMass(v, from, ingredient); ok {
+		if converted, err := units.Convert(grams, "g", to); err == nil {
+			return converted, true
+		}
+	}
+	return 0, false
+}
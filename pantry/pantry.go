@@ -0,0 +1,104 @@
+// Package pantry answers "what can I cook?": given the ingredients someone
+// has on hand, it ranks recipes by how much of each they could make.
+package pantry
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/models"
+)
+
+// Staples are assumed to be in every kitchen when the caller asks for it, so
+// a recipe isn't held back for want of salt.
+var Staples = []string{"water", "salt", "black pepper", "olive oil", "vegetable oil"}
+
+// Match is how well the ingredients on hand cover one recipe.
+type Match struct {
+	Recipe  models.Recipe
+	Have    []string // ingredient lines covered, as the recipe names them
+	Missing []string // ingredient lines not covered
+}
+
+// Coverage is the fraction of the recipe's ingredients on hand, from 0 to 1.
+func (m Match) Coverage() float64 {
+	total := len(m.Have) + len(m.Missing)
+	if total == 0 {
+		return 0
+	}
+	return float64(len(m.Have)) / float64(total)
+}
+
+// Percent is Coverage as a whole percentage, for display.
+func (m Match) Percent() int {
+	return int(m.Coverage()*100 + 0.5)
+}
+
+// Parse splits a list of ingredients typed one per line, or separated by
+// commas, into names.
+func Parse(list string) []string {
+	var names []string
+	for _, name := range strings.FieldsFunc(list, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Rank matches recipes against the ingredients on hand and returns those
+// using at least one of them, the best covered first, then those missing the
+// fewest. Recipes must have their Ingredients (and Ingredients.Ingredient)
+// loaded.
+func Rank(recipes []models.Recipe, have []string) []Match {
+	onHand := make([]string, 0, len(have))
+	for _, name := range have {
+		if key := catalog.Name(name); key != "" {
+			onHand = append(onHand, key)
+		}
+	}
+
+	var matches []Match
+	for _, recipe := range recipes {
+		match := Match{Recipe: recipe}
+		for _, ri := range recipe.Ingredients {
+			key := ri.Ingredient.Name
+			if key == "" {
+				key = catalog.Name(ri.DisplayName())
+			}
+			if covers(onHand, key) {
+				match.Have = append(match.Have, ri.DisplayName())
+			} else {
+				match.Missing = append(match.Missing, ri.DisplayName())
+			}
+		}
+		if len(match.Have) > 0 {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if ci, cj := matches[i].Coverage(), matches[j].Coverage(); ci != cj {
+			return ci > cj
+		}
+		if mi, mj := len(matches[i].Missing), len(matches[j].Missing); mi != mj {
+			return mi < mj
+		}
+		return strings.ToLower(matches[i].Recipe.FullName()) < strings.ToLower(matches[j].Recipe.FullName())
+	})
+	return matches
+}
+
+// covers reports whether any of the normalized names on hand is the
+// ingredient key, or a more general name for it: "chicken thigh" covers
+// "boneless skinless chicken thigh", but "chicken" doesn't cover "chicken
+// stock".
+func covers(onHand []string, key string) bool {
+	for _, name := range onHand {
+		if key == name || strings.HasSuffix(key, " "+name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,298 @@
+// Package pdf writes simple PDF documents: pages of text, lines, JPEG
+// images and links between pages. Text is set in the standard Helvetica
+// fonts every PDF reader has, so nothing is embedded, but it's limited to
+// the characters of Windows-1252; anything else prints as "?".
+//
+// Positions are in points (1/72 inch), measured from the top left corner of
+// the page. Text is placed by its baseline.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg" // for DecodeConfig
+	"io"
+	"strings"
+)
+
+// Page sizes, width by height.
+const (
+	LetterWidth  = 612
+	LetterHeight = 792
+)
+
+type Font int
+
+const (
+	Regular Font = iota
+	Bold
+	Italic
+)
+
+// fontNames are the standard fonts each Font is set in.
+var fontNames = [...]string{
+	Regular: "Helvetica",
+	Bold:    "Helvetica-Bold",
+	Italic:  "Helvetica-Oblique",
+}
+
+// Document is a PDF being built up a page at a time. Nothing is written
+// until WriteTo.
+type Document struct {
+	Title         string
+	Width, Height float64
+	pages         []*Page
+	images        []*Image
+}
+
+// New starts a document whose pages are width by height points.
+func New(width, height float64) *Document {
+	return &Document{Width: width, Height: height}
+}
+
+// Page is one page of a Document.
+type Page struct {
+	doc     *Document
+	content bytes.Buffer
+	links   []link
+	images  []*Image
+}
+
+type link struct {
+	x, y, w, h float64
+	to         *Page
+}
+
+// Image is a JPEG added to a Document, which any of its pages can draw.
+type Image struct {
+	Width, Height int
+	colorSpace    string
+	data          []byte
+}
+
+// AddPage adds a blank page to the end of the document.
+func (d *Document) AddPage() *Page {
+	p := &Page{doc: d}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the document's pages so far, in order.
+func (d *Document) Pages() []*Page {
+	return d.pages
+}
+
+// JPEG adds a JPEG image to the document. It's stored as it is, without
+// being decoded.
+func (d *Document) JPEG(data []byte) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if format != "jpeg" {
+		return nil, fmt.Errorf("pdf: image is %s, not jpeg", format)
+	}
+	img := &Image{Width: config.Width, Height: config.Height, data: data}
+	switch config.ColorModel {
+	case color.GrayModel:
+		img.colorSpace = "/DeviceGray"
+	case color.YCbCrModel:
+		img.colorSpace = "/DeviceRGB"
+	default:
+		return nil, fmt.Errorf("pdf: unsupported jpeg color model")
+	}
+	d.images = append(d.images, img)
+	return img, nil
+}
+
+// Text draws s with its baseline starting at x, y.
+func (p *Page) Text(x, y float64, font Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		font, num(size), num(x), num(p.doc.Height-y), escape(encode(s)))
+}
+
+// Line draws a line from x1, y1 to x2, y2.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		num(width), num(x1), num(p.doc.Height-y1), num(x2), num(p.doc.Height-y2))
+}
+
+// SetGray sets the color of what's drawn next, from black at 0 to white at
+// 1.
+func (p *Page) SetGray(level float64) {
+	fmt.Fprintf(&p.content, "%s g %s G\n", num(level), num(level))
+}
+
+// Image draws img scaled to w by h with its top left corner at x, y. img
+// must have been added to the page's document.
+func (p *Page) Image(img *Image, x, y, w, h float64) error {
+	n, ok := p.doc.imageIndex(img)
+	if !ok {
+		return errors.New("pdf: image from another document")
+	}
+	p.images = append(p.images, img)
+	fmt.Fprintf(&p.content, "q %s 0 0 %s %s %s cm /Im%d Do Q\n",
+		num(w), num(h), num(x), num(p.doc.Height-y-h), n)
+	return nil
+}
+
+// Link makes the w by h area with its top left corner at x, y go to page to
+// when clicked.
+func (p *Page) Link(x, y, w, h float64, to *Page) {
+	p.links = append(p.links, link{x, y, w, h, to})
+}
+
+func (d *Document) imageIndex(img *Image) (int, bool) {
+	for i, other := range d.images {
+		if other == img {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// WriteTo writes the finished document to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	pw := &writer{w: bufio.NewWriter(w)}
+
+	// Objects are numbered in the order they're written: the catalog, the
+	// page tree, the fonts, the images, then each page and its contents, and
+	// the document info last.
+	const catalog, pageTree = 1, 2
+	font := func(f int) int { return 3 + f }
+	xobject := func(i int) int { return font(len(fontNames)) + i }
+	page := func(i int) int { return xobject(len(d.images)) + 2*i }
+	info := page(len(d.pages))
+	pageNumbers := map[*Page]int{}
+	for i, p := range d.pages {
+		pageNumbers[p] = page(i)
+	}
+
+	pw.printf("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+
+	pw.object(catalog, "<< /Type /Catalog /Pages %d 0 R >>", pageTree)
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", page(i))
+	}
+	pw.object(pageTree, "<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %s %s] >>",
+		strings.Join(kids, " "), len(d.pages), num(d.Width), num(d.Height))
+
+	for i, name := range fontNames {
+		pw.object(font(i), "<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name)
+	}
+
+	for i, img := range d.images {
+		pw.stream(xobject(i), img.data, fmt.Sprintf(
+			"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /DCTDecode",
+			img.Width, img.Height, img.colorSpace))
+	}
+
+	var fonts []string
+	for i := range fontNames {
+		fonts = append(fonts, fmt.Sprintf("/F%d %d 0 R", i, font(i)))
+	}
+	for i, p := range d.pages {
+		var images []string
+		for _, img := range p.images {
+			n, _ := d.imageIndex(img) // Image only takes the document's own
+			images = append(images, fmt.Sprintf("/Im%d %d 0 R", n, xobject(n)))
+		}
+		var annots []string
+		for _, l := range p.links {
+			target, ok := pageNumbers[l.to]
+			if !ok {
+				continue
+			}
+			annots = append(annots, fmt.Sprintf("<< /Type /Annot /Subtype /Link /Rect [%s %s %s %s] /Border [0 0 0] /Dest [%d 0 R /Fit] >>",
+				num(l.x), num(d.Height-l.y-l.h), num(l.x+l.w), num(d.Height-l.y), target))
+		}
+
+		pw.object(page(i), "<< /Type /Page /Parent %d 0 R /Resources << /Font << %s >> /XObject << %s >> >> /Contents %d 0 R /Annots [%s] >>",
+			pageTree, strings.Join(fonts, " "), strings.Join(images, " "), page(i)+1, strings.Join(annots, " "))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(p.content.Bytes())
+		zw.Close()
+		pw.stream(page(i)+1, compressed.Bytes(), "/Filter /FlateDecode")
+	}
+
+	pw.object(info, "<< /Title (%s) /Producer (RecipeBook) >>", escape(encode(d.Title)))
+
+	xref := pw.n
+	pw.printf("xref\n0 %d\n0000000000 65535 f \n", info+1)
+	for _, offset := range pw.offsets {
+		pw.printf("%010d 00000 n \n", offset)
+	}
+	pw.printf("trailer\n<< /Size %d /Root %d 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", info+1, catalog, info, xref)
+
+	if pw.err == nil {
+		pw.err = pw.w.Flush()
+	}
+	return pw.n, pw.err
+}
+
+// writer keeps track of where each object starts, for the cross-reference
+// table at the end of the file. Objects must be written in number order.
+type writer struct {
+	w       *bufio.Writer
+	n       int64
+	offsets []int64
+	err     error
+}
+
+func (pw *writer) printf(format string, args ...any) {
+	pw.write([]byte(fmt.Sprintf(format, args...)))
+}
+
+func (pw *writer) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *writer) object(n int, format string, args ...any) {
+	pw.offsets = append(pw.offsets, pw.n)
+	pw.printf("%d 0 obj\n"+format+"\nendobj\n", append([]any{n}, args...)...)
+}
+
+func (pw *writer) stream(n int, data []byte, dict string) {
+	pw.offsets = append(pw.offsets, pw.n)
+	pw.printf("%d 0 obj\n<< %s /Length %d >>\nstream\n", n, dict, len(data))
+	pw.write(data)
+	pw.printf("\nendstream\nendobj\n")
+}
+
+// num formats a number without the trailing zeros fmt would give it.
+func num(f float64) string {
+	s := fmt.Sprintf("%.2f", f)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// escape makes s safe inside a PDF string's parentheses.
+func escape(s []byte) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '\\', '(', ')':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n', '\r':
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,32 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"testing"
+)
+
+func TestImageFromAnotherDocument(t *testing.T) {
+	var data bytes.Buffer
+	if err := jpeg.Encode(&data, image.NewGray(image.Rect(0, 0, 2, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+	other := New(LetterWidth, LetterHeight)
+	img, err := other.JPEG(data.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := New(LetterWidth, LetterHeight)
+	page := doc.AddPage()
+	if err := page.Image(img, 0, 0, 10, 10); err == nil {
+		t.Error("drew an image from another document")
+	}
+	if err := other.AddPage().Image(img, 0, 0, 10, 10); err != nil {
+		t.Errorf("drawing an image in its own document: %v", err)
+	}
+	if _, err := doc.WriteTo(&bytes.Buffer{}); err != nil {
+		t.Errorf("writing after a refused image: %v", err)
+	}
+}
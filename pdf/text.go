@@ -0,0 +1,131 @@
+package pdf
+
+import (
+	"strings"
+	"unicode"
+)
+
+// widths are the standard Helvetica metrics for the printable ASCII
+// characters, ' ' through '~', in thousandths of the font size. The oblique
+// face has the same widths as the regular one.
+var widths = [...][95]int{
+	Regular: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	Bold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// otherWidths are the widths of the characters beyond ASCII that recipes
+// use most. The rest are taken to be as wide as a digit.
+var otherWidths = map[byte]int{
+	0x85: 1000, // …
+	0x91: 222,  // ‘
+	0x92: 222,  // ’
+	0x93: 333,  // “
+	0x94: 333,  // ”
+	0x95: 350,  // •
+	0x96: 556,  // –
+	0x97: 1000, // —
+	0xb0: 400,  // °
+	0xb7: 278,  // ·
+	0xbc: 834,  // ¼
+	0xbd: 834,  // ½
+	0xbe: 834,  // ¾
+}
+
+// Width is how wide s is set in font at size, in points.
+func Width(font Font, size float64, s string) float64 {
+	metrics := widths[Regular]
+	if font == Bold {
+		metrics = widths[Bold]
+	}
+	total := 0
+	for _, c := range encode(s) {
+		switch {
+		case c >= ' ' && c <= '~':
+			total += metrics[c-' ']
+		case otherWidths[c] != 0:
+			total += otherWidths[c]
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// Wrap breaks s into lines no wider than width, breaking between words
+// where it can. Line breaks already in s are kept.
+func Wrap(font Font, size float64, s string, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		var line string
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line == "" || Width(font, size, candidate) <= width {
+				line = candidate
+			} else {
+				lines = append(lines, line)
+				line = word
+			}
+			// a word too long for a line of its own is cut wherever it must be
+			for Width(font, size, line) > width && len([]rune(line)) > 1 {
+				head := []rune(line)
+				n := len(head) - 1
+				for n > 1 && Width(font, size, string(head[:n])) > width {
+					n--
+				}
+				lines = append(lines, string(head[:n]))
+				line = string(head[n:])
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// windows1252 maps the characters Windows-1252 puts in 0x80 to 0x9f, where
+// Latin-1 has control characters, to their bytes. From 0xa0 up the two
+// agree.
+var windows1252 = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97,
+	'˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b, 'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// encode converts s to the Windows-1252 bytes the fonts are set up for.
+func encode(s string) []byte {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80 && unicode.IsPrint(r):
+			out = append(out, byte(r))
+		case r < 0x80:
+			out = append(out, ' ') // tabs and other control characters
+		case r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case windows1252[r] != 0:
+			out = append(out, windows1252[r])
+		case r == '⁄':
+			out = append(out, '/') // the fraction slash in "1⁄2"
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+// Package photos checks uploaded recipe photos and makes their thumbnails.
+// It sticks to the image formats the standard library decodes: JPEG, PNG and
+// GIF.
+package photos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+)
+
+const (
+	// MaxSize is the largest photo accepted, in bytes.
+	MaxSize = 10 << 20
+	// MaxPixels guards against small files that decode into huge images.
+	MaxPixels = 24_000_000
+	// ThumbnailSize is the longest side of a thumbnail, in pixels.
+	ThumbnailSize = 320
+)
+
+var (
+	ErrTooLarge    = fmt.Errorf("photos must be smaller than %d MB", MaxSize>>20)
+	ErrUnsupported = errors.New("photos must be JPEG, PNG or GIF images")
+)
+
+// extensions maps the content types we accept to the extension they're
+// stored with.
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Photo is an uploaded image that passed validation, ready to be stored.
+type Photo struct {
+	Data          []byte // the file as uploaded
+	ContentType   string
+	Ext           string
+	Width, Height int
+	Thumbnail     []byte // a JPEG no larger than ThumbnailSize on either side
+}
+
+// Prepare reads an uploaded file, checks it's an image we accept and makes
+// its thumbnail. The type is sniffed from the contents; whatever the browser
+// claimed is ignored. Errors other than ErrTooLarge and ErrUnsupported mean
+// the file couldn't be read or decoded.
+func Prepare(r io.Reader) (Photo, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxSize+1))
+	if err != nil {
+		return Photo{}, err
+	}
+	if len(data) > MaxSize {
+		return Photo{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := extensions[contentType]
+	if !ok {
+		return Photo{}, ErrUnsupported
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Photo{}, fmt.Errorf("couldn't read image: %w", err)
+	}
+	if config.Width*config.Height > MaxPixels {
+		return Photo{}, fmt.Errorf("photos must be smaller than %d megapixels", MaxPixels/1_000_000)
+	}
+
+	img, err := decode(contentType, data)
+	if err != nil {
+		return Photo{}, fmt.Errorf("couldn't read image: %w", err)
+	}
+
+	var thumb bytes.Buffer
+	if err := jpeg.Encode(&thumb, Thumbnail(img, ThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return Photo{}, err
+	}
+
+	return Photo{
+		Data:        data,
+		ContentType: contentType,
+		Ext:         ext,
+		Width:       config.Width,
+		Height:      config.Height,
+		Thumbnail:   thumb.Bytes(),
+	}, nil
+}
+
+func decode(contentType string, data []byte) (image.Image, error) {
+	switch contentType {
+	case "image/jpeg":
+		return jpeg.Decode(bytes.NewReader(data))
+	case "image/png":
+		return png.Decode(bytes.NewReader(data))
+	case "image/gif":
+		return gif.Decode(bytes.NewReader(data))
+	}
+	return nil, ErrUnsupported
+}
+
+// Thumbnail shrinks img to fit in a size×size square, keeping its aspect
+// ratio. Each thumbnail pixel averages the block of pixels it covers, which
+// is plenty for photos. Transparent areas become white, since thumbnails are
+// JPEGs. Images that already fit are only flattened.
+func Thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	src := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Over)
+
+	dw, dh := fit(sw, sh, size)
+	if dw == sw && dh == sh {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 == y0 {
+			y1++
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 == x0 {
+				x1++
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					sum[0] += int(p[0])
+					sum[1] += int(p[1])
+					sum[2] += int(p[2])
+					sum[3] += int(p[3])
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			i := dst.PixOffset(x, y)
+			for c := range sum {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// fit scales w×h down to fit in a size×size square.
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, h*size/w)
+	}
+	return max(1, w*size/h), size
+}
@@ -0,0 +1,105 @@
+// Package policy decides which recipes and recipe books a user may see or
+// change. Each rule is a gorm scope, so handlers apply it to the query that
+// loads the record:
+//
+//	c.DB.Scopes(policy.ViewableRecipes(userID)).First(&recipe, id)
+//
+// Anything the scope filters out simply isn't found, and handlers answer
+// with a 404 rather than revealing that the record exists.
+//
+// A user can reach a recipe book by creating it or by being one of its
+// members, and can reach a recipe by owning it or through a book that
+// contains it. What they can do there depends on their role in the book.
+// Variants of a recipe can be read wherever the recipe itself can, but only
+// changed by whoever could change them on their own.
+package policy
+
+import (
+	"github.com/imsteev/recipebook/models"
+	"gorm.io/gorm"
+)
+
+var (
+	anyRole      = []models.Role{models.RoleOwner, models.RoleEditor, models.RoleViewer}
+	editingRoles = []models.Role{models.RoleOwner, models.RoleEditor}
+	owningRoles  = []models.Role{models.RoleOwner}
+)
+
+// ViewableRecipes limits a query on recipes to the ones userID may read,
+// including the variants of any of them.
+func ViewableRecipes(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(recipes.user_id = ? OR recipes.id IN (`+bookRecipes+`) OR recipes.parent_id IN (`+parentRecipes+`))`,
+			userID, userID, userID, anyRole, userID, userID, userID, anyRole)
+	}
+}
+
+// EditableRecipes limits a query on recipes to the ones userID may change:
+// their own, and those in books where they're an owner or editor. Being able
+// to change a recipe doesn't extend to someone else's variants of it.
+func EditableRecipes(userID uint) func(*gorm.DB) *gorm.DB {
+	return recipesThrough(userID, editingRoles)
+}
+
+// ViewableRecipeBooks limits a query on recipe books to the ones userID may
+// read.
+func ViewableRecipeBooks(userID uint) func(*gorm.DB) *gorm.DB {
+	return booksWithRole(userID, anyRole)
+}
+
+// EditableRecipeBooks limits a query on recipe books to the ones userID may
+// add recipes to and rearrange.
+func EditableRecipeBooks(userID uint) func(*gorm.DB) *gorm.DB {
+	return booksWithRole(userID, editingRoles)
+}
+
+// OwnedRecipeBooks limits a query on recipe books to the ones userID owns.
+// Only owners can share a book and manage its members.
+func OwnedRecipeBooks(userID uint) func(*gorm.DB) *gorm.DB {
+	return booksWithRole(userID, owningRoles)
+}
+
+// RoleIn returns userID's role in recipebook, or "" if they have none.
+func RoleIn(db *gorm.DB, recipebook models.RecipeBook, userID uint) (models.Role, error) {
+	if recipebook.CreatedBy == userID {
+		return models.RoleOwner, nil
+	}
+	var members []models.RecipeBookMember
+	err := db.Where("recipe_book_id = ? AND user_id = ?", recipebook.ID, userID).Limit(1).Find(&members).Error
+	if err != nil || len(members) == 0 {
+		return "", err
+	}
+	return members[0].Role, nil
+}
+
+// memberBooks selects the IDs of books a user is a member of with one of the
+// given roles. It takes the user ID and the roles as parameters.
+const memberBooks = `SELECT recipe_book_members.recipe_book_id FROM recipe_book_members
+	WHERE recipe_book_members.user_id = ? AND recipe_book_members.role IN ? AND recipe_book_members.deleted_at IS NULL`
+
+func booksWithRole(userID uint, roles []models.Role) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(recipe_books.created_by = ? OR recipe_books.id IN ("+memberBooks+"))", userID, userID, roles)
+	}
+}
+
+// bookRecipes selects the IDs of recipes in books a user created or is a
+// member of with one of the given roles. It takes the user ID twice, then
+// the roles, as parameters.
+const bookRecipes = `SELECT recipe_book_recipes.recipe_id FROM recipe_book_recipes
+	JOIN recipe_books ON recipe_books.id = recipe_book_recipes.recipe_book_id AND recipe_books.deleted_at IS NULL
+	WHERE recipe_book_recipes.deleted_at IS NULL
+	AND (recipe_books.created_by = ? OR recipe_books.id IN (` + memberBooks + `))`
+
+func recipesThrough(userID uint, roles []models.Role) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`(recipes.user_id = ? OR recipes.id IN (`+bookRecipes+`))`, userID, userID, userID, roles)
+	}
+}
+
+// parentRecipes selects the IDs of recipes a user owns or reaches through a
+// book with one of the given roles, to find their variants by. It takes the
+// user ID three times, then the roles, as parameters.
+const parentRecipes = `SELECT parents.id FROM recipes parents
+	WHERE parents.deleted_at IS NULL
+	AND (parents.user_id = ? OR parents.id IN (` + bookRecipes + `))`
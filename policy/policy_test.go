@@ -0,0 +1,256 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/imsteev/recipebook/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens an empty in-memory database with the tables the policy
+// scopes query.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger:                           logger.Discard,
+		IgnoreRelationshipsWhenMigrating: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection would get a database of its own.
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	// Recipe's search vector is a Postgres full text index, so its table is
+	// made by hand, and the others are migrated without reaching for it.
+	err = db.Exec(`CREATE TABLE recipes (
+		id integer PRIMARY KEY, created_at datetime, updated_at datetime, deleted_at datetime,
+		user_id integer, name text, description text, servings integer, prep_time integer,
+		cook_time integer, source_url text, forked_from_id integer, parent_id integer, variant text,
+		overrides text
+	)`).Error
+	if err == nil {
+		err = db.AutoMigrate(&models.User{}, &models.RecipeBook{}, &models.RecipeBookMember{}, &models.RecipeBookRecipe{})
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// fixture is a recipe book owned by one user, with one recipe of theirs in
+// it, shared with a viewer and an editor, and a stranger who has nothing to
+// do with any of it.
+type fixture struct {
+	owner, viewer, editor, stranger models.User
+	book                            models.RecipeBook
+	recipe                          models.Recipe
+	editorMember                    models.RecipeBookMember
+}
+
+func newFixture(t *testing.T, db *gorm.DB) fixture {
+	t.Helper()
+	var f fixture
+	mustCreate(t, db, &f.owner, &f.viewer, &f.editor, &f.stranger)
+	f.book = models.RecipeBook{CreatedBy: f.owner.ID, Name: "Family favourites"}
+	f.recipe = models.Recipe{UserID: f.owner.ID, Name: "Stew"}
+	f.editorMember = models.RecipeBookMember{UserID: f.editor.ID, Role: models.RoleEditor}
+	mustCreate(t, db, &f.book, &f.recipe)
+	f.editorMember.RecipeBookID = f.book.ID
+	mustCreate(t, db,
+		&models.RecipeBookRecipe{RecipeBookID: f.book.ID, RecipeID: f.recipe.ID},
+		&models.RecipeBookMember{RecipeBookID: f.book.ID, UserID: f.viewer.ID, Role: models.RoleViewer},
+		&f.editorMember,
+	)
+	return f
+}
+
+// mustCreate saves records without their hooks, which keep Postgres' search
+// index up to date.
+func mustCreate(t *testing.T, db *gorm.DB, records ...any) {
+	t.Helper()
+	db = db.Session(&gorm.Session{SkipHooks: true})
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// allowed reports whether scope lets a query on model's table find the row
+// id.
+func allowed(t *testing.T, db *gorm.DB, model any, id uint, scope func(*gorm.DB) *gorm.DB) bool {
+	t.Helper()
+	var count int64
+	if err := db.Model(model).Scopes(scope).Where("id = ?", id).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count > 0
+}
+
+func TestRecipeScopes(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	tests := []struct {
+		name       string
+		user       models.User
+		view, edit bool
+	}{
+		{"stranger", f.stranger, false, false},
+		{"viewer", f.viewer, true, false},
+		{"editor", f.editor, true, true},
+		{"owner", f.owner, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed(t, db, &models.Recipe{}, f.recipe.ID, ViewableRecipes(tt.user.ID)); got != tt.view {
+				t.Errorf("ViewableRecipes = %v, want %v", got, tt.view)
+			}
+			if got := allowed(t, db, &models.Recipe{}, f.recipe.ID, EditableRecipes(tt.user.ID)); got != tt.edit {
+				t.Errorf("EditableRecipes = %v, want %v", got, tt.edit)
+			}
+		})
+	}
+}
+
+func TestRecipeBookScopes(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	tests := []struct {
+		name            string
+		user            models.User
+		view, edit, own bool
+	}{
+		{"stranger", f.stranger, false, false, false},
+		{"viewer", f.viewer, true, false, false},
+		{"editor", f.editor, true, true, false},
+		{"owner", f.owner, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed(t, db, &models.RecipeBook{}, f.book.ID, ViewableRecipeBooks(tt.user.ID)); got != tt.view {
+				t.Errorf("ViewableRecipeBooks = %v, want %v", got, tt.view)
+			}
+			if got := allowed(t, db, &models.RecipeBook{}, f.book.ID, EditableRecipeBooks(tt.user.ID)); got != tt.edit {
+				t.Errorf("EditableRecipeBooks = %v, want %v", got, tt.edit)
+			}
+			if got := allowed(t, db, &models.RecipeBook{}, f.book.ID, OwnedRecipeBooks(tt.user.ID)); got != tt.own {
+				t.Errorf("OwnedRecipeBooks = %v, want %v", got, tt.own)
+			}
+		})
+	}
+}
+
+func TestRemovedEditorLosesAccess(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	if err := db.Delete(&f.editorMember).Error; err != nil {
+		t.Fatal(err)
+	}
+	if allowed(t, db, &models.Recipe{}, f.recipe.ID, ViewableRecipes(f.editor.ID)) {
+		t.Error("removed editor can still see the book's recipe")
+	}
+	if allowed(t, db, &models.Recipe{}, f.recipe.ID, EditableRecipes(f.editor.ID)) {
+		t.Error("removed editor can still edit the book's recipe")
+	}
+	if allowed(t, db, &models.RecipeBook{}, f.book.ID, ViewableRecipeBooks(f.editor.ID)) {
+		t.Error("removed editor can still see the book")
+	}
+}
+
+func TestDeletedBookGrantsNothing(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	if err := db.Delete(&f.book).Error; err != nil {
+		t.Fatal(err)
+	}
+	if allowed(t, db, &models.Recipe{}, f.recipe.ID, ViewableRecipes(f.viewer.ID)) {
+		t.Error("viewer of a deleted book can still see its recipe")
+	}
+	if !allowed(t, db, &models.Recipe{}, f.recipe.ID, ViewableRecipes(f.owner.ID)) {
+		t.Error("owner lost their own recipe with the book")
+	}
+}
+
+func TestRoleIn(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	tests := []struct {
+		user models.User
+		want models.Role
+	}{
+		{f.stranger, ""},
+		{f.viewer, models.RoleViewer},
+		{f.editor, models.RoleEditor},
+		{f.owner, models.RoleOwner},
+	}
+	for _, tt := range tests {
+		got, err := RoleIn(db, f.book, tt.user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("RoleIn(user %d) = %q, want %q", tt.user.ID, got, tt.want)
+		}
+	}
+}
+
+func TestVariantScopes(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	// The editor makes their own variant of the book's recipe, without
+	// putting it in the book.
+	variant := models.Recipe{UserID: f.editor.ID, ParentID: &f.recipe.ID, Variant: "Vegan"}
+	mustCreate(t, db, &variant)
+
+	tests := []struct {
+		name       string
+		user       models.User
+		view, edit bool
+	}{
+		{"stranger", f.stranger, false, false},
+		{"viewer", f.viewer, true, false},
+		{"editor", f.editor, true, true},
+		{"owner of the original", f.owner, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := allowed(t, db, &models.Recipe{}, variant.ID, ViewableRecipes(tt.user.ID)); got != tt.view {
+				t.Errorf("ViewableRecipes = %v, want %v", got, tt.view)
+			}
+			if got := allowed(t, db, &models.Recipe{}, variant.ID, EditableRecipes(tt.user.ID)); got != tt.edit {
+				t.Errorf("EditableRecipes = %v, want %v", got, tt.edit)
+			}
+		})
+	}
+}
+
+func TestVariantInBookIsEditableByBookEditors(t *testing.T) {
+	db := newTestDB(t)
+	f := newFixture(t, db)
+
+	variant := models.Recipe{UserID: f.stranger.ID, ParentID: &f.recipe.ID, Variant: "Vegan"}
+	mustCreate(t, db, &variant)
+	mustCreate(t, db, &models.RecipeBookRecipe{RecipeBookID: f.book.ID, RecipeID: variant.ID})
+
+	if !allowed(t, db, &models.Recipe{}, variant.ID, EditableRecipes(f.owner.ID)) {
+		t.Error("book owner can't edit a variant in their book")
+	}
+	if !allowed(t, db, &models.Recipe{}, variant.ID, EditableRecipes(f.editor.ID)) {
+		t.Error("book editor can't edit a variant in the book")
+	}
+	if allowed(t, db, &models.Recipe{}, variant.ID, EditableRecipes(f.viewer.ID)) {
+		t.Error("book viewer can edit a variant in the book")
+	}
+}
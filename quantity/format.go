@@ -0,0 +1,144 @@
+package quantity
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/imsteev/recipebook/units"
+)
+
+// Scale multiplies the amount by factor, moving to a bigger or smaller unit
+// when the result reads better that way (6 tsp becomes 2 tbsp, 1500 g
+// becomes 1.5 kg). Amounts without a number are returned unchanged.
+func (a Amount) Scale(factor float64) Amount {
+	if a.Value == 0 || factor == 1 {
+		return a
+	}
+	scaled := Amount{
+		Value: a.Value * factor,
+		Max:   a.Max * factor,
+		Unit:  a.Unit,
+	}
+	scaled.Text = scaled.String()
+	return scaled.Tidy()
+}
+
+// Tidy moves the amount into whichever unit of its own system reads best,
+// e.g. 6 tsp becomes 2 tbsp. Units we only convert from, like pints, are
+// left alone.
+func (a Amount) Tidy() Amount {
+	u, ok := units.Lookup(a.Unit)
+	if a.Value == 0 || !ok || !units.OnLadder(a.Unit) {
+		return a
+	}
+	tidy := a.rewrite(u.System)
+	tidy.Text = tidy.String()
+	return tidy
+}
+
+// In converts the amount to the given measurement system ("1 cup" becomes
+// "240 ml"). Counts, unknown units and amounts without a number are returned
+// unchanged.
+func (a Amount) In(system units.System) Amount {
+	u, ok := units.Lookup(a.Unit)
+	if a.Value == 0 || !ok || u.System == "" || u.System == system {
+		return a
+	}
+	converted := a.rewrite(system)
+	converted.Text = converted.String()
+	return converted
+}
+
+// Weighed converts a volume of ingredient into a mass in the given system,
+// for the staples we know the density of ("1 cup flour" becomes "120 g").
+// Anything else is returned unchanged.
+func (a Amount) Weighed(ingredient string, system units.System) Amount {
+	grams, ok := units.VolumeToMass(a.Value, a.Unit, ingredient)
+	if a.Value == 0 || !ok {
+		return a
+	}
+	maxGrams, _ := units.VolumeToMass(a.Max, a.Unit, ingredient)
+	weighed := Amount{Value: grams, Max: maxGrams, Unit: "g"}.rewrite(system)
+	weighed.Text = weighed.String()
+	return weighed
+}
+
+// rewrite moves Value and Max into the unit of system that best fits Value.
+func (a Amount) rewrite(system units.System) Amount {
+	value, unit := units.Best(a.Value, a.Unit, system)
+	if a.IsRange() {
+		a.Max, _ = units.Convert(a.Max, a.Unit, unit)
+	}
+	a.Value, a.Unit = value, unit
+	return a
+}
+
+// String renders the amount the way a cook would write it: "3/4 cup",
+// "1 1/2-2 tbsp", "250 g". Amounts without a number fall back to Text.
+func (a Amount) String() string {
+	if a.Value == 0 {
+		return a.Text
+	}
+	s := FormatNumber(a.Value, a.Unit)
+	if a.IsRange() {
+		s += "-" + FormatNumber(a.Max, a.Unit)
+	}
+	if a.Unit == "" {
+		return s
+	}
+	unit := a.Unit
+	if plural, ok := plurals[unit]; ok && math.Max(a.Value, a.Max) > 1 {
+		unit = plural
+	}
+	return s + " " + unit
+}
+
+// FormatNumber renders v as a fraction for US customary units and counts
+// ("1 1/2", "3/4") and as a rounded decimal for metric units ("250", "1.5").
+func FormatNumber(v float64, unit string) string {
+	if u, ok := units.Lookup(unit); ok && u.System == units.Metric {
+		if v >= 10 {
+			return strconv.FormatFloat(math.Round(v), 'f', -1, 64)
+		}
+		return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+	}
+
+	whole, frac := math.Modf(v)
+	for _, den := range []float64{2, 3, 4, 8} {
+		num := math.Round(frac * den)
+		if math.Abs(frac-num/den) > 0.02 {
+			continue
+		}
+		switch {
+		case num == 0:
+			return strconv.FormatFloat(whole, 'f', -1, 64)
+		case num == den:
+			return strconv.FormatFloat(whole+1, 'f', -1, 64)
+		case whole == 0:
+			return fmt.Sprintf("%g/%g", num, den)
+		default:
+			return fmt.Sprintf("%g %g/%g", whole, num, den)
+		}
+	}
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// plurals are the units that are written out as words rather than
+// abbreviated, and so need an "s" past one.
+var plurals = map[string]string{
+	"cup":     "cups",
+	"pint":    "pints",
+	"quart":   "quarts",
+	"gallon":  "gallons",
+	"pinch":   "pinches",
+	"dash":    "dashes",
+	"clove":   "cloves",
+	"can":     "cans",
+	"stick":   "sticks",
+	"slice":   "slices",
+	"piece":   "pieces",
+	"bunch":   "bunches",
+	"sprig":   "sprigs",
+	"package": "packages",
+}
@@ -0,0 +1,368 @@
+// Package quantity parses the free-form amounts people type next to an
+// ingredient ("1 1/2 cups", "2-3", "½ tsp") into a number and a unit.
+package quantity
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Amount is a parsed ingredient quantity.
+type Amount struct {
+	Value float64 // 0 when no number was given, e.g. "to taste"
+	Max   float64 // upper bound for ranges like "2-3", otherwise 0
+	Unit  string  // canonical unit ("tbsp", "g", ...), or the word as typed if unknown
+	Text  string  // the original input, kept for display
+}
+
+// IsRange reports whether the amount was written as a range.
+func (a Amount) IsRange() bool {
+	return a.Max > a.Value
+}
+
+// Parse reads an amount such as "1 1/2 cups", "2-3 tbsp", "½ tsp" or "200g".
+// It never fails: whatever can't be understood is left zero, and the input
+// is always kept in Text.
+func Parse(s string) Amount {
+	a := Amount{Text: strings.TrimSpace(s)}
+	rest := a.Text
+
+	counted := true
+	if v, r, ok := parseNumber(rest); ok {
+		a.Value = v
+		rest = r
+		if max, r, ok := parseRangeEnd(rest, v); ok {
+			a.Max = max
+			rest = r
+		}
+	} else if r, ok := cutArticle(rest); ok {
+		// "a pinch", "an onion"
+		a.Value = 1
+		rest = r
+	} else {
+		counted = false
+	}
+
+	unit, known := parseUnit(rest)
+	if known || counted {
+		// without a number only a known unit counts: "pinch" but not "to taste"
+		a.Unit = unit
+	}
+	return a
+}
+
+// Split separates a whole ingredient line, as found in pasted or imported
+// recipes, into its amount and the ingredient: "2 cups flour, sifted" is
+// "2 cups" of "flour, sifted", and "a pinch of salt" is "a pinch" of "salt".
+// A line without an amount is all ingredient.
+func Split(line string) (amount, ingredient string) {
+	line = strings.TrimSpace(line)
+	rest := line
+	if v, r, ok := parseNumber(rest); ok {
+		rest = r
+		if _, r, ok := parseRangeEnd(rest, v); ok {
+			rest = r
+		}
+		rest = cutUnit(rest)
+	} else if r, ok := cutArticle(rest); ok {
+		// "a pinch of salt", but not "an onion"
+		if after := cutUnit(r); after != strings.TrimLeft(r, " ") {
+			rest = after
+		}
+	}
+
+	ingredient = strings.TrimSpace(rest)
+	if lower := strings.ToLower(ingredient); strings.HasPrefix(lower, "of ") {
+		ingredient = strings.TrimSpace(ingredient[len("of "):])
+	}
+	if ingredient == "" {
+		return "", line
+	}
+	return strings.TrimSpace(line[:len(line)-len(rest)]), ingredient
+}
+
+// cutUnit removes a known unit word, or two for "fl oz", from the front of s.
+func cutUnit(s string) string {
+	s = strings.TrimLeft(s, " ")
+	for _, n := range []int{2, 1} {
+		words := strings.SplitN(s, " ", n+1)
+		if len(words) < n {
+			continue
+		}
+		if _, ok := lookupUnit(strings.TrimRight(strings.Join(words[:n], " "), ",")); ok {
+			if len(words) > n {
+				return strings.TrimLeft(words[n], " ")
+			}
+			return ""
+		}
+	}
+	return s
+}
+
+// vulgarFractions are the unicode fraction characters people paste in from
+// other recipe sites.
+var vulgarFractions = map[rune]float64{
+	'½': 1.0 / 2,
+	'⅓': 1.0 / 3,
+	'⅔': 2.0 / 3,
+	'¼': 1.0 / 4,
+	'¾': 3.0 / 4,
+	'⅕': 1.0 / 5,
+	'⅖': 2.0 / 5,
+	'⅗': 3.0 / 5,
+	'⅘': 4.0 / 5,
+	'⅙': 1.0 / 6,
+	'⅚': 5.0 / 6,
+	'⅛': 1.0 / 8,
+	'⅜': 3.0 / 8,
+	'⅝': 5.0 / 8,
+	'⅞': 7.0 / 8,
+}
+
+type numberKind int
+
+const (
+	kindInteger numberKind = iota
+	kindDecimal
+	kindFraction
+)
+
+// parseNumber reads a number from the front of s, including mixed numbers
+// like "1 1/2", "1½" and "1-1/2", as the last is often written in US
+// recipes.
+func parseNumber(s string) (float64, string, bool) {
+	v, rest, kind, ok := readNumber(s)
+	if !ok {
+		return 0, s, false
+	}
+	if kind != kindInteger {
+		return v, rest, true
+	}
+	after := strings.TrimLeft(rest, " ")
+	if strings.HasPrefix(rest, "-") {
+		after = rest[len("-"):]
+	}
+	if frac, r, fkind, ok := readNumber(after); ok && fkind == kindFraction && frac < 1 {
+		return v + frac, r, true
+	}
+	return v, rest, true
+}
+
+// readNumber reads a single integer, decimal, fraction ("3/4") or unicode
+// fraction ("¾") from the front of s.
+func readNumber(s string) (float64, string, numberKind, bool) {
+	s = strings.TrimLeft(s, " ")
+	if s == "" {
+		return 0, s, 0, false
+	}
+
+	first, size := firstRune(s)
+	if v, ok := vulgarFractions[first]; ok {
+		return v, s[size:], kindFraction, true
+	}
+
+	digits := leadingDigits(s)
+	if digits == "" {
+		return 0, s, 0, false
+	}
+	rest := s[len(digits):]
+
+	switch {
+	case strings.HasPrefix(rest, ".") && leadingDigits(rest[1:]) != "":
+		decimals := leadingDigits(rest[1:])
+		v, err := strconv.ParseFloat(digits+"."+decimals, 64)
+		if err != nil {
+			return 0, s, 0, false
+		}
+		return v, rest[1+len(decimals):], kindDecimal, true
+
+	case strings.HasPrefix(rest, "/") && leadingDigits(rest[1:]) != "":
+		denominator := leadingDigits(rest[1:])
+		num, _ := strconv.ParseFloat(digits, 64)
+		den, _ := strconv.ParseFloat(denominator, 64)
+		if den == 0 {
+			return 0, s, 0, false
+		}
+		return num / den, rest[1+len(denominator):], kindFraction, true
+	}
+
+	v, err := strconv.ParseFloat(digits, 64)
+	if err != nil {
+		return 0, s, 0, false
+	}
+	// "1½" with no space between the whole number and the fraction
+	if next, size := firstRune(rest); vulgarFractions[next] > 0 {
+		return v + vulgarFractions[next], rest[size:], kindDecimal, true
+	}
+	return v, rest, kindInteger, true
+}
+
+// parseRangeEnd reads the upper half of a range starting at from: "-3",
+// "– 3" or "to 3". A range has to go up, so anything at or below from isn't
+// one.
+func parseRangeEnd(s string, from float64) (float64, string, bool) {
+	rest := strings.TrimLeft(s, " ")
+	switch {
+	case strings.HasPrefix(rest, "-"):
+		rest = rest[len("-"):]
+	case strings.HasPrefix(rest, "–"):
+		rest = rest[len("–"):]
+	case strings.HasPrefix(rest, "—"):
+		rest = rest[len("—"):]
+	case strings.HasPrefix(strings.ToLower(rest), "to "):
+		rest = rest[len("to "):]
+	default:
+		return 0, s, false
+	}
+	v, r, ok := parseNumber(rest)
+	if !ok || v <= from {
+		return 0, s, false
+	}
+	return v, r, true
+}
+
+func cutArticle(s string) (string, bool) {
+	lower := strings.ToLower(s)
+	for _, article := range []string{"a ", "an "} {
+		if strings.HasPrefix(lower, article) {
+			return s[len(article):], true
+		}
+	}
+	return s, false
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
+
+func firstRune(s string) (rune, int) {
+	for i, r := range s {
+		if i == 0 {
+			return r, len(string(r))
+		}
+	}
+	return 0, 0
+}
+
+// parseUnit reads the unit word (or two words, for "fl oz") from the front of
+// s. Known units are returned in canonical form; anything else is returned
+// lowercased as typed, so "3 sprinkles" still records "sprinkles".
+func parseUnit(s string) (string, bool) {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || r == ','
+	})
+	if len(words) == 0 {
+		return "", false
+	}
+	if len(words) >= 2 {
+		if unit, ok := lookupUnit(words[0] + " " + words[1]); ok {
+			return unit, true
+		}
+	}
+	if unit, ok := lookupUnit(words[0]); ok {
+		return unit, true
+	}
+	return strings.ToLower(strings.TrimSuffix(words[0], ".")), false
+}
+
+// unitAliases maps the spellings we accept to a canonical unit. Single
+// letter abbreviations are case sensitive ("T" is a tablespoon, "t" a
+// teaspoon) so they are matched before lowercasing.
+var unitAliases = map[string]string{
+	"t": "tsp",
+	"T": "tbsp",
+	"c": "cup",
+	"C": "cup",
+	"g": "g",
+	"G": "g",
+	"l": "l",
+	"L": "l",
+
+	"tsp":          "tsp",
+	"tsps":         "tsp",
+	"teaspoon":     "tsp",
+	"teaspoons":    "tsp",
+	"tbsp":         "tbsp",
+	"tbsps":        "tbsp",
+	"tbs":          "tbsp",
+	"tbl":          "tbsp",
+	"tablespoon":   "tbsp",
+	"tablespoons":  "tbsp",
+	"cup":          "cup",
+	"cups":         "cup",
+	"fl oz":        "fl oz",
+	"floz":         "fl oz",
+	"fluid ounce":  "fl oz",
+	"fluid ounces": "fl oz",
+	"pt":           "pint",
+	"pint":         "pint",
+	"pints":        "pint",
+	"qt":           "quart",
+	"quart":        "quart",
+	"quarts":       "quart",
+	"gal":          "gallon",
+	"gallon":       "gallon",
+	"gallons":      "gallon",
+	"ml":           "ml",
+	"milliliter":   "ml",
+	"milliliters":  "ml",
+	"millilitre":   "ml",
+	"millilitres":  "ml",
+	"liter":        "l",
+	"liters":       "l",
+	"litre":        "l",
+	"litres":       "l",
+	"mg":           "mg",
+	"gr":           "g",
+	"gram":         "g",
+	"grams":        "g",
+	"kg":           "kg",
+	"kilogram":     "kg",
+	"kilograms":    "kg",
+	"oz":           "oz",
+	"ounce":        "oz",
+	"ounces":       "oz",
+	"lb":           "lb",
+	"lbs":          "lb",
+	"pound":        "lb",
+	"pounds":       "lb",
+	"pinch":        "pinch",
+	"pinches":      "pinch",
+	"dash":         "dash",
+	"dashes":       "dash",
+	"clove":        "clove",
+	"cloves":       "clove",
+	"can":          "can",
+	"cans":         "can",
+	"stick":        "stick",
+	"sticks":       "stick",
+	"slice":        "slice",
+	"slices":       "slice",
+	"piece":        "piece",
+	"pieces":       "piece",
+	"bunch":        "bunch",
+	"bunches":      "bunch",
+	"sprig":        "sprig",
+	"sprigs":       "sprig",
+	"package":      "package",
+	"packages":     "package",
+	"pkg":          "package",
+}
+
+func lookupUnit(word string) (string, bool) {
+	word = strings.TrimSuffix(word, ".")
+	if unit, ok := unitAliases[word]; ok {
+		return unit, true
+	}
+	unit, ok := unitAliases[strings.ToLower(word)]
+	if ok && len(word) == 1 {
+		// single letters only match with their exact case
+		return "", false
+	}
+	return unit, ok
+}
@@ -0,0 +1,93 @@
+package quantity
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in    string
+		value float64
+		max   float64
+		unit  string
+	}{
+		{"2", 2, 0, ""},
+		{"1 1/2 cups", 1.5, 0, "cup"},
+		{"1-1/2 cups", 1.5, 0, "cup"},
+		{"2-3/4 cup", 2.75, 0, "cup"},
+		{"1½ tsp", 1.5, 0, "tsp"},
+		{"1 ½ tsp", 1.5, 0, "tsp"},
+		{"½ tsp", 0.5, 0, "tsp"},
+		{"3/4 cup", 0.75, 0, "cup"},
+		{"0.5 kg", 0.5, 0, "kg"},
+		{"200g", 200, 0, "g"},
+		{"2-3", 2, 3, ""},
+		{"2 - 3 tbsp", 2, 3, "tbsp"},
+		{"2–3 tbsp", 2, 3, "tbsp"},
+		{"2 to 3 cloves", 2, 3, "clove"},
+		{"1/2-1 cup", 0.5, 1, "cup"},
+		{"1 1/2-2 tbsp", 1.5, 2, "tbsp"},
+		{"1 T", 1, 0, "tbsp"},
+		{"1 t", 1, 0, "tsp"},
+		{"2 fl oz", 2, 0, "fl oz"},
+		{"a pinch", 1, 0, "pinch"},
+		{"an onion", 1, 0, "onion"},
+		{"3 sprinkles", 3, 0, "sprinkles"},
+		{"pinch", 0, 0, "pinch"},
+		{"to taste", 0, 0, ""},
+		{"", 0, 0, ""},
+	}
+	for _, tt := range tests {
+		got := Parse(tt.in)
+		if got.Value != tt.value || got.Max != tt.max || got.Unit != tt.unit {
+			t.Errorf("Parse(%q) = %v, %v, %q; want %v, %v, %q", tt.in, got.Value, got.Max, got.Unit, tt.value, tt.max, tt.unit)
+		}
+		if got.Text != tt.in {
+			t.Errorf("Parse(%q).Text = %q", tt.in, got.Text)
+		}
+	}
+}
+
+func TestParseRejectsRangesThatDontGoUp(t *testing.T) {
+	for _, in := range []string{"3-2 cups", "2-2 cups", "1 to 1/2 cup"} {
+		if got := Parse(in); got.IsRange() || got.Max != 0 {
+			t.Errorf("Parse(%q) is a range up to %v", in, got.Max)
+		}
+	}
+}
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"1-1/2 cups", "1 1/2 cups"},
+		{"1 1/2-2 tbsp", "1 1/2-2 tbsp"},
+		{"½ tsp", "1/2 tsp"},
+		{"200g", "200 g"},
+		{"to taste", "to taste"},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.in).String(); got != tt.want {
+			t.Errorf("Parse(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		line, amount, ingredient string
+	}{
+		{"2 cups flour, sifted", "2 cups", "flour, sifted"},
+		{"1-1/2 cups milk", "1-1/2 cups", "milk"},
+		{"2-3 cloves garlic", "2-3 cloves", "garlic"},
+		{"a pinch of salt", "a pinch", "salt"},
+		{"an onion", "", "an onion"},
+		{"3 eggs", "3", "eggs"},
+		{"salt to taste", "", "salt to taste"},
+		{"2 cups", "", "2 cups"},
+	}
+	for _, tt := range tests {
+		amount, ingredient := Split(tt.line)
+		if amount != tt.amount || ingredient != tt.ingredient {
+			t.Errorf("Split(%q) = %q, %q; want %q, %q", tt.line, amount, ingredient, tt.amount, tt.ingredient)
+		}
+	}
+}
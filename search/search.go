@@ -0,0 +1,129 @@
+// Package search finds recipes with Postgres full-text search.
+//
+// Each recipe keeps a weighted tsvector of its name (A), ingredient names,
+// description and tags (B) and steps (C) in recipes.search_vector, so
+// matches in the name rank above matches buried in the method. Reindex
+// refreshes it whenever a recipe is saved.
+package search
+
+import (
+	"html/template"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// MaxResults caps how many hits a search returns.
+const MaxResults = 50
+
+// A variant leaves what it doesn't override to the recipe it's a variant
+// of, so that's looked up there. Wrapped around a field's column name,
+// setsField and endSets are true of a recipe that sets the field itself
+// (see models.Recipe.Overrides).
+const (
+	setsField = `(recipes.parent_id IS NULL OR recipes.overrides LIKE '%"`
+	endSets   = `"%')`
+)
+
+// name is the recipe's name. It's correlated on recipes.id, like all of
+// these.
+const name = `CASE WHEN ` + setsField + `name` + endSets + ` THEN recipes.name
+	ELSE (SELECT parents.name FROM recipes AS parents WHERE parents.id = recipes.parent_id) END`
+
+// description is the recipe's description.
+const description = `CASE WHEN ` + setsField + `description` + endSets + ` THEN recipes.description
+	ELSE (SELECT parents.description FROM recipes AS parents WHERE parents.id = recipes.parent_id) END`
+
+// ingredientNames is the recipe's ingredient names, as written, separated by
+// commas.
+const ingredientNames = `(SELECT string_agg(COALESCE(NULLIF(recipe_ingredients.name, ''), ingredients.name), ', ' ORDER BY recipe_ingredients.position)
+	FROM recipe_ingredients
+	LEFT JOIN ingredients ON ingredients.id = recipe_ingredients.ingredient_id
+	WHERE recipe_ingredients.recipe_id = CASE WHEN ` + setsField + `ingredients` + endSets + ` THEN recipes.id ELSE recipes.parent_id END
+	AND recipe_ingredients.deleted_at IS NULL)`
+
+// tagNames is the recipe's tags separated by spaces.
+const tagNames = `(SELECT string_agg(tags.name, ' ')
+	FROM recipe_tags
+	JOIN tags ON tags.id = recipe_tags.tag_id
+	WHERE recipe_tags.recipe_id = CASE WHEN ` + setsField + `tags` + endSets + ` THEN recipes.id ELSE recipes.parent_id END)`
+
+// stepTexts is the recipe's steps in order.
+const stepTexts = `(SELECT string_agg(recipe_steps.text, ' ' ORDER BY recipe_steps.position)
+	FROM recipe_steps
+	WHERE recipe_steps.recipe_id = CASE WHEN ` + setsField + `steps` + endSets + ` THEN recipes.id ELSE recipes.parent_id END
+	AND recipe_steps.deleted_at IS NULL)`
+
+const document = `setweight(to_tsvector('english', concat_ws(' ', ` + name + `, recipes.variant)), 'A') ||
+	setweight(to_tsvector('english', COALESCE(` + ingredientNames + `, '')), 'B') ||
+	setweight(to_tsvector('english', COALESCE(` + description + `, '')), 'B') ||
+	setweight(to_tsvector('english', COALESCE(` + tagNames + `, '')), 'B') ||
+	setweight(to_tsvector('english', COALESCE(` + stepTexts + `, '')), 'C')`
+
+// Matched words are wrapped in these by ts_headline. They're control
+// characters so they can't clash with anything the author wrote, and
+// Highlight turns them into <mark> after escaping the rest.
+const (
+	startSel = "\x01"
+	stopSel  = "\x02"
+)
+
+// Reindex recomputes the search vector of one recipe, and of its variants,
+// which index what they inherit from it. Call it after the recipe, its
+// ingredients or its steps change.
+func Reindex(db *gorm.DB, recipeID uint) error {
+	return db.Exec("UPDATE recipes SET search_vector = "+document+" WHERE recipes.id = ? OR recipes.parent_id = ?", recipeID, recipeID).Error
+}
+
+// ReindexMissing computes the search vector of every recipe that doesn't
+// have one yet, such as those saved before search existed.
+func ReindexMissing(db *gorm.DB) error {
+	return db.Exec("UPDATE recipes SET search_vector = " + document + " WHERE recipes.search_vector IS NULL").Error
+}
+
+// Hit is a recipe matching a search.
+type Hit struct {
+	ID      uint
+	Name    string // with what sets it apart if it's a variant
+	Rank    float64
+	Snippet string
+}
+
+// Highlight returns the snippet as HTML with the matched words in <mark>.
+func (h Hit) Highlight() template.HTML {
+	s := template.HTMLEscapeString(h.Snippet)
+	s = strings.ReplaceAll(s, startSel, "<mark>")
+	s = strings.ReplaceAll(s, stopSel, "</mark>")
+	return template.HTML(s)
+}
+
+// Recipes is a scope on a query of recipes that keeps those matching input,
+// best first, selecting the columns of a Hit. Every word of input has to
+// match, and the last may be the start of a word so results keep up with
+// someone typing.
+func Recipes(input string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Select(`recipes.id, concat_ws(': ', `+name+`, NULLIF(recipes.variant, '')) AS name,
+				ts_rank(recipes.search_vector, query) AS rank,
+				ts_headline('english', concat_ws(' … ', NULLIF(`+description+`, ''), `+ingredientNames+`, `+stepTexts+`), query, ?) AS snippet`,
+			`StartSel="`+startSel+`", StopSel="`+stopSel+`", MaxWords=30, MinWords=10, MaxFragments=2`).
+			Joins("CROSS JOIN to_tsquery('english', ?) AS query", Query(input)).
+			Where("recipes.search_vector @@ query").
+			Order("rank DESC, recipes.updated_at DESC").
+			Limit(MaxResults)
+	}
+}
+
+// Query turns what someone typed into a tsquery. Anything but letters and
+// digits separates words, so the result is always valid tsquery syntax.
+func Query(input string) string {
+	words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	words[len(words)-1] += ":*"
+	return strings.Join(words, " & ")
+}
@@ -0,0 +1,110 @@
+package shopping
+
+import (
+	"strings"
+
+	"github.com/imsteev/recipebook/catalog"
+)
+
+// Categories are the store aisles we group a list by, in the order you'd
+// walk through a typical grocery store.
+var Categories = []string{
+	"Produce",
+	"Meat & Seafood",
+	"Dairy & Eggs",
+	"Bakery",
+	"Pantry",
+	"Spices & Seasonings",
+	"Frozen",
+	"Other",
+}
+
+// aisles maps an ingredient (or the last word of one, so "red onion" finds
+// "onion") to its category.
+var aisles = map[string]string{
+	"apple": "Produce", "apples": "Produce", "avocado": "Produce", "banana": "Produce",
+	"basil": "Produce", "bell pepper": "Produce", "broccoli": "Produce", "cabbage": "Produce",
+	"carrot": "Produce", "carrots": "Produce", "celery": "Produce", "cilantro": "Produce",
+	"cucumber": "Produce", "garlic": "Produce", "ginger": "Produce", "kale": "Produce",
+	"lemon": "Produce", "lemons": "Produce", "lettuce": "Produce", "lime": "Produce",
+	"limes": "Produce", "mushroom": "Produce", "mushrooms": "Produce", "onion": "Produce",
+	"onions": "Produce", "parsley": "Produce", "pepper": "Produce", "potato": "Produce",
+	"potatoes": "Produce", "scallion": "Produce", "scallions": "Produce", "shallot": "Produce",
+	"spinach": "Produce", "tomato": "Produce", "tomatoes": "Produce", "zucchini": "Produce",
+	"berries": "Produce", "strawberries": "Produce", "blueberries": "Produce",
+
+	"bacon": "Meat & Seafood", "beef": "Meat & Seafood", "chicken": "Meat & Seafood",
+	"fish": "Meat & Seafood", "ham": "Meat & Seafood", "lamb": "Meat & Seafood",
+	"pork": "Meat & Seafood", "salmon": "Meat & Seafood", "sausage": "Meat & Seafood",
+	"shrimp": "Meat & Seafood", "turkey": "Meat & Seafood", "tuna": "Meat & Seafood",
+	"chicken breast": "Meat & Seafood", "chicken thighs": "Meat & Seafood",
+	"ground beef": "Meat & Seafood",
+
+	"butter": "Dairy & Eggs", "cheese": "Dairy & Eggs", "cream": "Dairy & Eggs",
+	"egg": "Dairy & Eggs", "eggs": "Dairy & Eggs", "milk": "Dairy & Eggs",
+	"yogurt": "Dairy & Eggs", "parmesan": "Dairy & Eggs", "mozzarella": "Dairy & Eggs",
+	"cheddar": "Dairy & Eggs", "sour cream": "Dairy & Eggs", "buttermilk": "Dairy & Eggs",
+
+	"bread": "Bakery", "buns": "Bakery", "baguette": "Bakery", "tortillas": "Bakery",
+	"tortilla": "Bakery", "pita": "Bakery",
+
+	"flour": "Pantry", "sugar": "Pantry", "rice": "Pantry", "pasta": "Pantry",
+	"spaghetti": "Pantry", "noodles": "Pantry", "oats": "Pantry", "oil": "Pantry",
+	"vinegar": "Pantry", "honey": "Pantry", "syrup": "Pantry", "beans": "Pantry",
+	"lentils": "Pantry", "stock": "Pantry", "broth": "Pantry", "soy sauce": "Pantry",
+	"baking soda": "Pantry", "baking powder": "Pantry", "yeast": "Pantry",
+	"chocolate chips": "Pantry", "cocoa powder": "Pantry", "breadcrumbs": "Pantry",
+	"tomato paste": "Pantry", "coconut milk": "Pantry", "peanut butter": "Pantry",
+	"vanilla": "Pantry", "vanilla extract": "Pantry", "water": "Pantry",
+
+	"salt": "Spices & Seasonings", "black pepper": "Spices & Seasonings",
+	"cumin": "Spices & Seasonings", "paprika": "Spices & Seasonings",
+	"cinnamon": "Spices & Seasonings", "oregano": "Spices & Seasonings",
+	"thyme": "Spices & Seasonings", "chili powder": "Spices & Seasonings",
+	"nutmeg": "Spices & Seasonings", "turmeric": "Spices & Seasonings",
+	"red pepper flakes": "Spices & Seasonings", "bay leaves": "Spices & Seasonings",
+	"garlic powder": "Spices & Seasonings", "onion powder": "Spices & Seasonings",
+
+	"frozen peas": "Frozen", "ice cream": "Frozen", "frozen corn": "Frozen",
+}
+
+// aislesByKey is aisles keyed by normalized ingredient name, so that it
+// matches catalog names.
+var aislesByKey = func() map[string]string {
+	m := make(map[string]string, len(aisles))
+	for name, category := range aisles {
+		m[catalog.Name(name)] = category
+	}
+	return m
+}()
+
+// Category returns the aisle an ingredient is usually found in. It tries the
+// full name first, then its last one and two words, and falls back to
+// "Other".
+func Category(ingredient string) string {
+	name := catalog.Name(ingredient)
+	if c, ok := aislesByKey[name]; ok {
+		return c
+	}
+	words := strings.Fields(name)
+	if len(words) >= 2 {
+		if c, ok := aislesByKey[strings.Join(words[len(words)-2:], " ")]; ok {
+			return c
+		}
+	}
+	if len(words) >= 1 {
+		if c, ok := aislesByKey[words[len(words)-1]]; ok {
+			return c
+		}
+	}
+	return "Other"
+}
+
+func categoryRank(category string) int {
+	for i, c := range Categories {
+		if c == category {
+			return i
+		}
+	}
+	return len(Categories)
+}
@@ -0,0 +1,126 @@
+// Package shopping turns the ingredient lists of several recipes into one
+// consolidated shopping list.
+package shopping
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/imsteev/recipebook/catalog"
+	"github.com/imsteev/recipebook/models"
+	"github.com/imsteev/recipebook/quantity"
+	"github.com/imsteev/recipebook/units"
+)
+
+// Item is one line of a consolidated shopping list.
+type Item struct {
+	Name     string
+	Category string
+	// Amounts that couldn't be added together, e.g. "2 cups" and "1 pinch".
+	Amounts []quantity.Amount
+}
+
+// Quantity renders all of the item's amounts, e.g. "2 cups + 1 pinch".
+func (it Item) Quantity() string {
+	parts := make([]string, 0, len(it.Amounts))
+	for _, a := range it.Amounts {
+		if s := a.String(); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " + ")
+}
+
+// FromRecipes merges the ingredients of recipes into shopping list items,
+// grouped by category and sorted by name within each category. A recipe
+// that appears twice counts twice. Recipes must have their Ingredients (and
+// Ingredients.Ingredient) loaded.
+func FromRecipes(recipes []models.Recipe) []Item {
+	var (
+		order  []string
+		byName = map[string]*Item{}
+	)
+	for _, recipe := range recipes {
+		for _, ri := range recipe.Ingredients {
+			key := ri.Ingredient.Name
+			if key == "" {
+				key = catalog.Name(ri.DisplayName())
+			}
+			item, ok := byName[key]
+			if !ok {
+				item = &Item{Name: ri.DisplayName(), Category: Category(key)}
+				byName[key] = item
+				order = append(order, key)
+			}
+			item.Amounts = add(item.Amounts, ri.Amount())
+		}
+	}
+
+	items := make([]Item, 0, len(order))
+	for _, key := range order {
+		items = append(items, *byName[key])
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		ci, cj := categoryRank(items[i].Category), categoryRank(items[j].Category)
+		if ci != cj {
+			return ci < cj
+		}
+		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+	})
+	return items
+}
+
+// add folds a into amounts, summing it with an existing amount it's
+// compatible with (same dimension, or the same count/unknown unit).
+func add(amounts []quantity.Amount, a quantity.Amount) []quantity.Amount {
+	if a.Value == 0 {
+		// "to taste" and friends: keep one copy so it still shows up
+		for _, existing := range amounts {
+			if existing.Value == 0 && existing.Text == a.Text {
+				return amounts
+			}
+		}
+		return append(amounts, a)
+	}
+
+	for i, existing := range amounts {
+		if existing.Value == 0 {
+			continue
+		}
+		if sum, ok := sum(existing, a); ok {
+			amounts[i] = sum
+			return amounts
+		}
+	}
+	return append(amounts, quantity.Amount{Value: a.Value, Max: a.Max, Unit: a.Unit})
+}
+
+// sum adds two amounts if their units can be converted into each other. The
+// result is expressed in the system of a.
+func sum(a, b quantity.Amount) (quantity.Amount, bool) {
+	if a.Unit == b.Unit {
+		return total(a, b, 1).Tidy(), true
+	}
+	converted, err := units.Convert(1, b.Unit, a.Unit)
+	if err != nil {
+		return quantity.Amount{}, false
+	}
+	// 2 tbsp + 1 cup reads better in cups than as 18 tbsp
+	return total(a, b, converted).Tidy(), true
+}
+
+// total is a + b, where b's numbers are multiplied by factor to put them in
+// a's unit. Ranges add up as ranges: 1-2 plus 3 is 4-5.
+func total(a, b quantity.Amount, factor float64) quantity.Amount {
+	upper := func(x quantity.Amount) float64 {
+		if x.IsRange() {
+			return x.Max
+		}
+		return x.Value
+	}
+	s := quantity.Amount{Value: a.Value + b.Value*factor, Unit: a.Unit}
+	if a.IsRange() || b.IsRange() {
+		s.Max = upper(a) + upper(b)*factor
+	}
+	return s
+}
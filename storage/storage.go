@@ -0,0 +1,108 @@
+// Package storage keeps uploaded files, such as recipe photos, outside the
+// database. Handlers talk to a Store so the files can live on local disk in
+// development and somewhere else later without touching them.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned by Open when nothing is stored under the key.
+var ErrNotFound = errors.New("storage: not found")
+
+// Store saves blobs under slash-separated keys like "photos/ab12.jpg".
+type Store interface {
+	// Put stores the contents of r under key, replacing anything there.
+	Put(key string, r io.Reader) error
+	// Open returns the blob stored under key. The caller closes it.
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the blob under key. Deleting a missing key is not an
+	// error.
+	Delete(key string) error
+}
+
+// Local is a Store on the local filesystem, rooted at Dir.
+type Local struct {
+	Dir string
+}
+
+// NewLocal returns a Local store in dir, creating dir if it doesn't exist.
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	return &Local{Dir: dir}, nil
+}
+
+func (s *Local) Put(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+
+	// Write to a temporary file first so a failed upload never leaves half
+	// a file under the key.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("storage: failed to write %q: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("storage: failed to write %q: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storage: %w", err)
+	}
+	return nil
+}
+
+func (s *Local) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: %w", err)
+	}
+	return f, nil
+}
+
+func (s *Local) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("storage: %w", err)
+	}
+	return nil
+}
+
+// path maps key to a file under Dir, refusing keys that would escape it.
+func (s *Local) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("storage: invalid key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return "", fmt.Errorf("storage: invalid key %q", key)
+		}
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,212 @@
+// Package units knows the kitchen units we parse out of recipes, how they
+// relate to each other, and how to move an amount between metric and US
+// customary.
+package units
+
+import (
+	"fmt"
+
+	"github.com/imsteev/recipebook/catalog"
+)
+
+type Dimension string
+
+const (
+	Volume Dimension = "volume"
+	Mass   Dimension = "mass"
+	Count  Dimension = "count"
+)
+
+type System string
+
+const (
+	Metric System = "metric"
+	US     System = "us"
+)
+
+// Unit is a canonical unit. Base is its size in millilitres for volumes,
+// grams for masses, and 1 for counts.
+type Unit struct {
+	Name      string
+	Dimension Dimension
+	System    System // empty for counts, which are the same everywhere
+	Base      float64
+}
+
+var all = map[string]Unit{
+	"tsp":    {"tsp", Volume, US, 4.92892},
+	"tbsp":   {"tbsp", Volume, US, 14.7868},
+	"fl oz":  {"fl oz", Volume, US, 29.5735},
+	"cup":    {"cup", Volume, US, 236.588},
+	"pint":   {"pint", Volume, US, 473.176},
+	"quart":  {"quart", Volume, US, 946.353},
+	"gallon": {"gallon", Volume, US, 3785.41},
+	"ml":     {"ml", Volume, Metric, 1},
+	"l":      {"l", Volume, Metric, 1000},
+	"oz":     {"oz", Mass, US, 28.3495},
+	"lb":     {"lb", Mass, US, 453.592},
+	"mg":     {"mg", Mass, Metric, 0.001},
+	"g":      {"g", Mass, Metric, 1},
+	"kg":     {"kg", Mass, Metric, 1000},
+
+	"pinch":   {"pinch", Count, "", 1},
+	"dash":    {"dash", Count, "", 1},
+	"clove":   {"clove", Count, "", 1},
+	"can":     {"can", Count, "", 1},
+	"stick":   {"stick", Count, "", 1},
+	"slice":   {"slice", Count, "", 1},
+	"piece":   {"piece", Count, "", 1},
+	"bunch":   {"bunch", Count, "", 1},
+	"sprig":   {"sprig", Count, "", 1},
+	"package": {"package", Count, "", 1},
+}
+
+// Lookup returns the unit with the given canonical name.
+func Lookup(name string) (Unit, bool) {
+	u, ok := all[name]
+	return u, ok
+}
+
+// Convert converts v from one unit to another of the same dimension.
+func Convert(v float64, from, to string) (float64, error) {
+	f, ok := all[from]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", from)
+	}
+	t, ok := all[to]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q", to)
+	}
+	if f.Dimension != t.Dimension || f.Dimension == Count && f.Name != t.Name {
+		return 0, fmt.Errorf("can't convert %s to %s", from, to)
+	}
+	return v * f.Base / t.Base, nil
+}
+
+// A ladder is a family of units in one system and dimension that people
+// actually cook with, from largest to smallest. Units not on a ladder (pints,
+// fluid ounces) can be converted from but are never picked.
+type ladder []rung
+
+type rung struct {
+	unit string
+	// min is the smallest amount (in this unit) we'd still write in it: a
+	// quarter cup reads fine, an eighth of a cup is better as 2 tbsp.
+	min float64
+}
+
+var ladders = map[Dimension]map[System]ladder{
+	Volume: {
+		US:     {{"cup", 0.25}, {"tbsp", 1}, {"tsp", 0}},
+		Metric: {{"l", 1}, {"ml", 0}},
+	},
+	Mass: {
+		US:     {{"lb", 1}, {"oz", 0}},
+		Metric: {{"kg", 1}, {"g", 0}},
+	},
+}
+
+// OnLadder reports whether unit is one we'd pick when rewriting amounts, as
+// opposed to one we only convert from.
+func OnLadder(unit string) bool {
+	u, ok := all[unit]
+	if !ok {
+		return false
+	}
+	for _, r := range ladders[u.Dimension][u.System] {
+		if r.unit == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// Best rewrites v (in unit) in whichever unit of the given system reads
+// best, e.g. 6 tsp is 2 tbsp and 1500 g is 1.5 kg. Counts and unknown units
+// are returned unchanged.
+func Best(v float64, unit string, system System) (float64, string) {
+	u, ok := all[unit]
+	if !ok {
+		return v, unit
+	}
+	l, ok := ladders[u.Dimension][system]
+	if !ok {
+		return v, unit
+	}
+	base := v * u.Base
+	for _, r := range l {
+		step := all[r.unit]
+		if base >= r.min*step.Base {
+			return base / step.Base, step.Name
+		}
+	}
+	last := all[l[len(l)-1].unit]
+	return base / last.Base, last.Name
+}
+
+// densities are grams per millilitre for staples that are commonly measured
+// by volume but weighed by serious bakers.
+var densities = map[string]float64{
+	"flour":               0.507, // 120 g per cup
+	"all-purpose flour":   0.507,
+	"all purpose flour":   0.507,
+	"bread flour":         0.537,
+	"whole wheat flour":   0.507,
+	"sugar":               0.845, // 200 g per cup
+	"granulated sugar":    0.845,
+	"white sugar":         0.845,
+	"brown sugar":         0.93,
+	"powdered sugar":      0.507,
+	"confectioners sugar": 0.507,
+	"butter":              0.959, // 227 g per cup
+	"unsalted butter":     0.959,
+	"salted butter":       0.959,
+	"water":               1,
+	"milk":                1.03,
+	"heavy cream":         1.01,
+	"honey":               1.42,
+	"maple syrup":         1.32,
+	"oil":                 0.92,
+	"olive oil":           0.92,
+	"vegetable oil":       0.92,
+	"salt":                1.2,
+	"kosher salt":         0.54,
+	"rice":                0.79,
+	"rolled oats":         0.38,
+	"oats":                0.38,
+	"cocoa powder":        0.42,
+	"unsweetened cocoa":   0.42,
+	"baking soda":         0.92,
+	"baking powder":       0.81,
+	"chocolate chips":     0.72,
+}
+
+// densitiesByKey is densities keyed by catalog name, so that it matches
+// however the ingredient is written.
+var densitiesByKey = func() map[string]float64 {
+	m := make(map[string]float64, len(densities))
+	for name, density := range densities {
+		m[catalog.Name(name)] = density
+	}
+	return m
+}()
+
+// Density returns grams per millilitre for a known ingredient.
+func Density(ingredient string) (float64, bool) {
+	d, ok := densitiesByKey[catalog.Name(ingredient)]
+	return d, ok
+}
+
+// VolumeToMass converts a volume of ingredient into grams, if we know how
+// dense the ingredient is.
+func VolumeToMass(v float64, unit string, ingredient string) (float64, bool) {
+	u, ok := all[unit]
+	if !ok || u.Dimension != Volume {
+		return 0, false
+	}
+	d, ok := Density(ingredient)
+	if !ok {
+		return 0, false
+	}
+	return v * u.Base * d, true
+}
@@ -0,0 +1,28 @@
+package units
+
+import "testing"
+
+func TestDensity(t *testing.T) {
+	tests := []struct {
+		ingredient string
+		want       float64
+	}{
+		{"flour", 0.507},
+		{"Flour, sifted", 0.507},
+		{"oats", 0.38},
+		{"oat", 0.38},
+		{"rolled oats", 0.38},
+		{"chocolate chips", 0.72},
+		{"chocolate chip", 0.72},
+		{"Brown Sugar, packed", 0.93},
+	}
+	for _, tt := range tests {
+		got, ok := Density(tt.ingredient)
+		if !ok || got != tt.want {
+			t.Errorf("Density(%q) = %v, %v; want %v", tt.ingredient, got, ok, tt.want)
+		}
+	}
+	if _, ok := Density("saffron"); ok {
+		t.Error("Density(saffron) found a density")
+	}
+}
@@ -3,8 +3,8 @@ package views
 import (
 	"embed"
 	"fmt"
+	"html/template"
 	"net/http"
-	"text/template"
 )
 
 //go:embed *.html
@@ -12,16 +12,31 @@ var allViews embed.FS
 
 type Engine struct {
 	baseTemplate string
+	partials     []string
 }
 
-func NewEngine(baseTemplate string) *Engine {
-	return &Engine{baseTemplate: baseTemplate}
+// NewEngine returns an engine that renders pages inside baseTemplate. The
+// templates defined in partials are available to every page.
+func NewEngine(baseTemplate string, partials ...string) *Engine {
+	return &Engine{baseTemplate: baseTemplate, partials: partials}
 }
 
 func (e *Engine) Render(w http.ResponseWriter, templateName string, data any) error {
-	t, err := template.ParseFS(allViews, e.baseTemplate, templateName)
+	files := append(append([]string{e.baseTemplate}, e.partials...), templateName)
+	t, err := template.ParseFS(allViews, files...)
 	if err != nil {
 		return fmt.Errorf("failed to parse templates: %w", err)
 	}
 	return t.ExecuteTemplate(w, "base", data)
 }
+
+// RenderPartial renders a single named template from templateName without
+// the base layout, for htmx swaps.
+func (e *Engine) RenderPartial(w http.ResponseWriter, templateName string, name string, data any) error {
+	files := append(append([]string{}, e.partials...), templateName)
+	t, err := template.ParseFS(allViews, files...)
+	if err != nil {
+		return fmt.Errorf("failed to parse templates: %w", err)
+	}
+	return t.ExecuteTemplate(w, name, data)
+}